@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/markgemmill/localq/queue"
+	"github.com/spf13/afero"
 	"os"
 	"time"
 )
@@ -14,11 +16,14 @@ type DemoOptions struct {
 	RandErrPer     float64
 }
 
-func InitializeTasks(options DemoOptions) (*queue.Queue, error) {
-	tasks := queue.GetQueue(options.QueueDir)
-	err := tasks.Register(&PrintTask{
+func InitializeTasks(options DemoOptions) (*queue.MasterQ, error) {
+	tasks, err := queue.New(options.QueueDir, afero.NewOsFs(), 0777)
+	if err != nil {
+		return nil, err
+	}
+	err = tasks.Register(&PrintTask{
 		MaxExecutionSeconds: options.MaxExecSeconds,
-	})
+	}, "print")
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +39,7 @@ func SendCommand(options DemoOptions) {
 	}
 	count := 0
 	for {
-		err := tasks.Enqueue(new(PrintTask)).Send(PrintTaskOptions{Name: fmt.Sprintf("Hello foo #%d", count)})
+		_, err := tasks.Enqueue("print").Send(PrintTaskOptions{Name: fmt.Sprintf("Hello foo #%d", count)})
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -51,17 +56,21 @@ func RunCommand(options DemoOptions) {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	count := 0
-	for {
-		count += 1
-		fmt.Println("Scan Tasks...")
-		tasks.RunAllTasks(count)
-		time.Sleep(time.Second * time.Duration(options.Throttle))
+	worker := queue.NewWorker(tasks, queue.WorkerOptions{
+		PollInterval: time.Second * time.Duration(options.Throttle),
+		OnResult: func(result queue.TaskResult) {
+			fmt.Printf("TASK %s %s/%s in %s\n", result.Outcome, result.Queue, result.Id, result.Duration)
+		},
+	})
+	err = worker.Run(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 }
 
 func FindCommand(options DemoOptions) {
-	tasks, err := InitializeTasks(options)
+	_, err := InitializeTasks(options)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -7,4 +7,7 @@ require github.com/alecthomas/kong v0.7.0
 require (
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/markgemmill/localq v0.1.1
+	github.com/spf13/afero v1.4.0
 )
+
+replace github.com/markgemmill/localq => ../
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/markgemmill/localq/queue"
 	"math/rand"
-	"path"
 	"time"
 )
 
@@ -37,19 +36,18 @@ func (t *PrintTask) RaiseError() bool {
 	return t.RandomErrors > 0.0 && rand.Float64() <= t.RandomErrors
 }
 
-func (t *PrintTask) Execute(filePath string, runId int) error {
-	name := path.Base(filePath)
-	opts, err := queue.ReadTaskFile[PrintTaskOptions](filePath)
+func (t *PrintTask) Execute(jsonData []byte) error {
+	opts, err := queue.ReadTaskData[PrintTaskOptions](jsonData)
 	if err != nil {
 		return err
 	}
 
 	if t.RaiseError() {
-		fmt.Printf("TASK ERR %d: %s: %s\n", runId, name, opts.Name)
+		fmt.Printf("TASK ERR: %s\n", opts.Name)
 		return fmt.Errorf("A randomly selected error occurred!")
 	}
 
 	time.Sleep(CalcExecutionTime(t.MaxExecutionSeconds))
-	fmt.Printf("TASK EXE %d: %s: %s\n", runId, name, opts.Name)
+	fmt.Printf("TASK EXE: %s\n", opts.Name)
 	return nil
 }
@@ -3,7 +3,6 @@ module github.com/markgemmill/localq
 go 1.20
 
 require (
-	github.com/matoous/go-nanoid/v2 v2.0.0
 	github.com/spf13/afero v1.4.0
 	github.com/stretchr/testify v1.8.4
 )
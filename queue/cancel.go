@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrTaskCancelled is recorded for a task instance that was
+// cancelled before it finished.
+var ErrTaskCancelled = errors.New("task cancelled")
+
+// cancelPollInterval is how often a running task instance
+// is checked for a cancel request.
+const cancelPollInterval = 100 * time.Millisecond
+
+// CancelFile returns the Path object of the file marking
+// that the task was asked to be cancelled.
+func (ti TaskInstance) CancelFile() Path {
+	return ti.TaskDir().Join(fmt.Sprintf("%s.cancel", ti.id))
+}
+
+// IsCancelRequested is true once the task was asked to be cancelled.
+func (ti TaskInstance) IsCancelRequested() bool {
+	return ti.CancelFile().Exists()
+}
+
+// Cancel cancels the task. A pending task is moved into cancelled
+// right away. A running task is marked to be cancelled, and the
+// worker executing it cancels the context of its executor and moves
+// it into cancelled once the executor returns. Cancelling a finished
+// task returns an error.
+func (ti TaskInstance) Cancel() (TaskInstance, error) {
+	queue := TaskQueue{
+		root: ti.root.Parent().Parent(),
+		name: ti.name,
+	}
+	return queue.cancel(ti)
+}
+
+// Cancel cancels the task instance id of the queue,
+// whatever state it is in.
+func (tq TaskQueue) Cancel(id string) (TaskInstance, error) {
+	instance, err := tq.Lookup(id)
+	if err != nil {
+		return instance, err
+	}
+	return tq.cancel(instance)
+}
+
+func (tq TaskQueue) cancel(instance TaskInstance) (TaskInstance, error) {
+	// the instance can be claimed, or finish, while we are at it,
+	// in which case we look for it again.
+	for attempt := 0; attempt < 3; attempt++ {
+		switch instance.State() {
+		case StatePending:
+			claimed, err := instance.Claim()
+			if err == nil {
+				err = tq.markCancelled(&claimed)
+				return claimed, errors.Join(err, claimed.ReleaseLock())
+			}
+			if !errors.Is(err, ErrTaskLocked) {
+				return instance, err
+			}
+			// somebody is claiming it, who will find the marker.
+			err = instance.requestCancel()
+			if !errors.Is(err, os.ErrNotExist) {
+				return instance, err
+			}
+		case StateRunning:
+			err := instance.requestCancel()
+			if !errors.Is(err, os.ErrNotExist) {
+				return instance, err
+			}
+		default:
+			return instance, fmt.Errorf("cannot cancel %s task %s", instance.State(), instance.id)
+		}
+		var err error
+		instance, err = tq.Lookup(instance.id)
+		if err != nil {
+			return instance, err
+		}
+	}
+	return instance, fmt.Errorf("cannot cancel task %s: %w", instance.id, ErrTaskLocked)
+}
+
+// requestCancel writes the cancel marker into the task folder,
+// failing with os.ErrNotExist if the folder was moved meanwhile.
+func (ti TaskInstance) requestCancel() error {
+	cancelFile := ti.CancelFile()
+	fh, err := openLockFile(cancelFile.fs, cancelFile.String())
+	if err != nil {
+		return err
+	}
+	return fh.Close()
+}
+
+// markCancelled records the cancellation of the claimed
+// instance in its error file and moves it into cancelled.
+func (tq TaskQueue) markCancelled(instance *TaskInstance) error {
+	err := instance.AddError(TaskExecutionError{
+		Timestamp: time.Now(),
+		Error:     ErrTaskCancelled.Error(),
+		Kind:      ErrorCancelled,
+	})
+	if err != nil {
+		return err
+	}
+	*instance, err = instance.MoveTo(StateCancelled)
+	if err != nil {
+		return err
+	}
+	return tq.finishKey(*instance)
+}
+
+// watchCancel cancels the context of a running task once it is
+// asked to be cancelled, until the returned stop function is called.
+func (ti TaskInstance) watchCancel(cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if ti.IsCancelRequested() {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
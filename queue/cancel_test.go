@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTaskInstance_CancelPending(t *testing.T) {
+	tq := MakeTaskQueue(false)
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("hello"))
+	assert.Nil(t, err)
+
+	cancelled, err := ti.Cancel()
+	assert.Nil(t, err)
+	assert.Equal(t, StateCancelled, cancelled.State())
+	assert.Equal(t, StatusCancelled, cancelled.Status())
+	assert.False(t, cancelled.IsLocked())
+	taskErrors, err := cancelled.GetErrors()
+	assert.Nil(t, err)
+	last, ok := taskErrors.Last()
+	assert.True(t, ok)
+	assert.Equal(t, ErrorCancelled, last.Kind)
+
+	err = tq.Handle(ti.id).Wait(context.Background())
+	assert.ErrorIs(t, err, ErrTaskCancelled)
+
+	// the key is free again once the task is cancelled.
+	_, err = tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("hello"))
+	assert.Nil(t, err)
+
+	// finished tasks cannot be cancelled.
+	_, err = tq.Cancel(ti.id)
+	assert.NotNil(t, err)
+}
+
+func TestTaskInstance_CancelRequested(t *testing.T) {
+	tq := MakeTaskQueue(false)
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithDelay(time.Hour))
+	assert.Nil(t, err)
+
+	// a marked pending task is cancelled by the runner,
+	// whether it is due or not.
+	assert.Nil(t, ti.requestCancel())
+	assert.True(t, ti.IsCancelRequested())
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeCancelled, result.Outcome)
+	assert.Nil(t, result.Error)
+
+	status, err := tq.GetStatus(ti.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusCancelled, status)
+}
+
+func TestTaskQueue_CancelRunning(t *testing.T) {
+	tq, err := NewContextTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 0777),
+		"sleep",
+		&SleepTask{},
+	)
+	assert.Nil(t, err)
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	results := make(chan TaskResult)
+	go func() {
+		results <- tq.ExecuteTask(ti)
+	}()
+	assert.Eventually(t, func() bool {
+		status, err := tq.GetStatus(ti.id)
+		return err == nil && status == StatusRunning
+	}, time.Second, 5*time.Millisecond)
+
+	running, err := tq.Cancel(ti.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StateRunning, running.State())
+	assert.True(t, running.IsCancelRequested())
+
+	result := <-results
+	assert.Equal(t, OutcomeCancelled, result.Outcome)
+	assert.ErrorIs(t, result.Error, context.Canceled)
+	assert.Less(t, result.Duration, time.Second)
+
+	cancelled, err := tq.FindTaskInstance(StateCancelled, ti.id)
+	assert.Nil(t, err)
+	assert.False(t, cancelled.IsLocked())
+	assert.ErrorIs(t, cancelled.Handle().Wait(context.Background()), ErrTaskCancelled)
+}
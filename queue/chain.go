@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// stagingDir holds follow up task instances while they are written,
+// so they only ever appear in pending complete.
+const stagingDir = "staging"
+
+// DeriveFunc derives the arguments of a follow up task instance
+// from the result of the task instance it follows.
+type DeriveFunc func(result []byte) (any, error)
+
+var derivers = struct {
+	sync.RWMutex
+	funcs map[string]DeriveFunc
+}{funcs: make(map[string]DeriveFunc)}
+
+// RegisterDerive registers a derive function for follow ups to refer
+// to by name. Functions cannot be kept on disk, so every process that
+// executes task instances with such follow ups has to register them.
+func RegisterDerive(name string, derive DeriveFunc) error {
+	if name == "" {
+		return errors.New("derive name is empty")
+	}
+	derivers.Lock()
+	defer derivers.Unlock()
+	_, ok := derivers.funcs[name]
+	if ok {
+		return fmt.Errorf("derive '%s' is already registered", name)
+	}
+	derivers.funcs[name] = derive
+	return nil
+}
+
+// UnregisterDerive removes the derive function registered as name.
+func UnregisterDerive(name string) {
+	derivers.Lock()
+	defer derivers.Unlock()
+	delete(derivers.funcs, name)
+}
+
+func getDerive(name string) (DeriveFunc, error) {
+	derivers.RLock()
+	defer derivers.RUnlock()
+	derive, ok := derivers.funcs[name]
+	if !ok {
+		return nil, fmt.Errorf("derive '%s' is not registered", name)
+	}
+	return derive, nil
+}
+
+// FollowUp is a task instance sent to another queue of the same root
+// once the task instance it follows has succeeded. Its arguments are
+// Args, or the value returned for the result of the task it follows
+// by the derive function registered as Derive.
+type FollowUp struct {
+	Queue  string `json:"queue"`
+	Args   any    `json:"args,omitempty"`
+	Derive string `json:"derive,omitempty"`
+	// Id is the id of the follow up task instance. It is picked,
+	// and recorded, before any of the follow ups are sent.
+	Id string `json:"id,omitempty"`
+}
+
+// followUpQueue returns the queue name registered with
+// the MasterQ the queue belongs to.
+func (tq TaskQueue) followUpQueue(name string) (TaskQueue, error) {
+	master, ok := globalQ[tq.root.Parent().String()]
+	if !ok {
+		return TaskQueue{}, fmt.Errorf("task '%s' is not registered", name)
+	}
+	return master.Get(name)
+}
+
+// checkFollowUps makes sure the follow ups of a task instance about
+// to be sent can be sent once it succeeds. Their arguments are checked
+// by the executor of their queue, now or, when they are derived, once
+// they are.
+func (tq TaskQueue) checkFollowUps(followUps []FollowUp) error {
+	for i := range followUps {
+		followUp := &followUps[i]
+		followUp.Id = ""
+		queue, err := tq.followUpQueue(followUp.Queue)
+		if err != nil {
+			return err
+		}
+		if followUp.Derive != "" {
+			_, err = getDerive(followUp.Derive)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = queue.task.Assert(followUp.Args)
+		if err != nil {
+			return fmt.Errorf("invalid %s follow up task options: %w", followUp.Queue, err)
+		}
+		_, err = json.Marshal(followUp.Args)
+		if err != nil {
+			return fmt.Errorf("invalid %s follow up task options: %w", followUp.Queue, err)
+		}
+	}
+	return nil
+}
+
+// followUpsRecorded is true once the task succeeded and the
+// ids of its follow ups were recorded.
+func (ti TaskInstance) followUpsRecorded() bool {
+	meta, err := ti.GetMeta()
+	return err == nil && len(meta.FollowUps) > 0 && meta.FollowUps[0].Id != ""
+}
+
+// sendFollowUps sends the follow ups of the succeeded instance. Their
+// ids are recorded before any is sent, so when sending them fails, or
+// the worker goes away half way, the instance is attempted again only
+// to send the remaining follow ups, each of them once.
+func (tq TaskQueue) sendFollowUps(instance TaskInstance) error {
+	meta, err := instance.GetMeta()
+	if err != nil || len(meta.FollowUps) == 0 {
+		return err
+	}
+	if !instance.followUpsRecorded() {
+		for i := range meta.FollowUps {
+			meta.FollowUps[i].Id = NewTaskId()
+		}
+		err = instance.WriteMeta(meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	var result []byte
+	if instance.ResultFile().Exists() {
+		result, err = instance.ResultFile().Read()
+		if err != nil {
+			return err
+		}
+	}
+	var errs []error
+	for _, followUp := range meta.FollowUps {
+		err = tq.sendFollowUp(followUp, result)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("follow up %s %s: %w", followUp.Queue, followUp.Id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (tq TaskQueue) sendFollowUp(followUp FollowUp, result []byte) error {
+	queue, err := tq.followUpQueue(followUp.Queue)
+	if err != nil {
+		return err
+	}
+	_, err = queue.Lookup(followUp.Id)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	args := followUp.Args
+	if followUp.Derive != "" {
+		derive, err := getDerive(followUp.Derive)
+		if err != nil {
+			return err
+		}
+		args, err = derive(result)
+		if err != nil {
+			return err
+		}
+		err = queue.task.Assert(args)
+		if err != nil {
+			return Permanent(fmt.Errorf("invalid %s follow up task options: %w", followUp.Queue, err))
+		}
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return Permanent(err)
+	}
+	staged := queue.newTaskInstance(followUp.Id, 0)
+	staged.root = queue.root.Join(stagingDir, staged.root.Name())
+	staged, err = queue.write(staged, data, TaskMeta{})
+	if err != nil {
+		return err
+	}
+	_, err = staged.MoveTo(StatePending)
+	return err
+}
+
+// FollowUps returns handles on the follow ups of the task instance.
+// It is empty until the task instance has succeeded.
+func (h TaskHandle) FollowUps() ([]TaskHandle, error) {
+	handles := []TaskHandle{}
+	instance, err := h.Instance()
+	if err != nil {
+		return handles, err
+	}
+	meta, err := instance.GetMeta()
+	if err != nil {
+		return handles, err
+	}
+	for _, followUp := range meta.FollowUps {
+		if followUp.Id == "" {
+			continue
+		}
+		queue := TaskQueue{
+			root: h.queue.root.Parent().Join(followUp.Queue),
+			name: followUp.Queue,
+		}
+		handles = append(handles, queue.Handle(followUp.Id))
+	}
+	return handles, nil
+}
@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"errors"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func MakeChainQueues(t *testing.T) (TaskQueue, TaskQueue) {
+	master, err := New("/chain", afero.NewMemMapFs(), 07777)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		delete(globalQ, master.root.String())
+	})
+	assert.Nil(t, master.RegisterResult(SumTask{}, "sum", WithRetry(RetryPolicy{MaxAttempts: 2})))
+	assert.Nil(t, master.RegisterResult(SumTask{}, "total"))
+	return master.Enqueue("sum"), master.Enqueue("total")
+}
+
+func RegisterChainDerive(t *testing.T, name string, derive DeriveFunc) {
+	assert.Nil(t, RegisterDerive(name, derive))
+	t.Cleanup(func() {
+		UnregisterDerive(name)
+	})
+}
+
+func TestTaskQueue_SendWithFollowUps(t *testing.T) {
+	first, second := MakeChainQueues(t)
+	RegisterChainDerive(t, "chain-sum", func(result []byte) (any, error) {
+		sum, err := ReadTaskData[map[string]int](result)
+		return []int{sum["sum"], 10}, err
+	})
+	assert.NotNil(t, RegisterDerive("chain-sum", nil))
+
+	_, err := first.Send([]int{1}, SendWithFollowUps(FollowUp{Queue: "missing"}))
+	assert.NotNil(t, err)
+	_, err = first.Send([]int{1}, SendWithFollowUps(FollowUp{Queue: "total", Derive: "missing"}))
+	assert.NotNil(t, err)
+	// the args are checked by the executor of the follow up queue.
+	_, err = first.Send([]int{1}, SendWithFollowUps(FollowUp{Queue: "total", Args: "nope"}))
+	assert.NotNil(t, err)
+
+	ti, err := first.Send([]int{1, 2, 3}, SendWithFollowUps(
+		FollowUp{Queue: "total", Derive: "chain-sum"},
+		FollowUp{Queue: "total", Args: []int{4, 5}},
+	))
+	assert.Nil(t, err)
+	handle := ti.Handle()
+	followUps, err := handle.FollowUps()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(followUps))
+
+	assert.Equal(t, OutcomeSucceeded, first.ExecuteTask(ti).Outcome)
+	followUps, err = handle.FollowUps()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(followUps))
+
+	for _, followUp := range followUps {
+		instance, err := followUp.Instance()
+		assert.Nil(t, err)
+		assert.Equal(t, OutcomeSucceeded, second.ExecuteTask(instance).Outcome)
+	}
+	data, err := followUps[0].Result()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"sum": 16}`, string(data))
+	data, err = followUps[1].Result()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"sum": 9}`, string(data))
+}
+
+func TestTaskQueue_FollowUpsRetried(t *testing.T) {
+	first, second := MakeChainQueues(t)
+	calls := 0
+	RegisterChainDerive(t, "chain-flaky", func(result []byte) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("derive failed")
+		}
+		return []int{1}, nil
+	})
+
+	ti, err := first.Send([]int{1, 2}, SendWithFollowUps(
+		FollowUp{Queue: "total", Args: []int{2}},
+		FollowUp{Queue: "total", Derive: "chain-flaky"},
+	))
+	assert.Nil(t, err)
+
+	// the failed follow up is recorded, and the task retried.
+	result := first.ExecuteTask(ti)
+	assert.Equal(t, OutcomeRetrying, result.Outcome)
+	assert.ErrorContains(t, result.Error, "derive failed")
+	pending, err := second.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+
+	retry, err := first.FindTaskInstance(StatePending, ti.id)
+	assert.Nil(t, err)
+	assert.False(t, retry.IsLocked())
+	taskErrors, err := retry.GetErrors()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, taskErrors.Count())
+
+	// a follow up left half written does not count as sent.
+	meta, err := retry.GetMeta()
+	assert.Nil(t, err)
+	staged := second.root.Join(stagingDir, taskDirName(meta.FollowUps[1].Id, 0))
+	assert.Nil(t, staged.MkDirs())
+
+	// the remaining follow up is sent, and the first not again.
+	assert.Equal(t, OutcomeSucceeded, first.ExecuteTask(retry).Outcome)
+	pending, err = second.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pending))
+	assert.True(t, pending[1].TaskFile().Exists())
+	assert.False(t, staged.Exists())
+	assert.Equal(t, 2, calls)
+	status, err := first.GetStatus(ti.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusSucceeded, status)
+}
+
+func TestTaskQueue_FollowUpsDeadLettered(t *testing.T) {
+	first, second := MakeChainQueues(t)
+	RegisterChainDerive(t, "chain-broken", func(result []byte) (any, error) {
+		return nil, errors.New("derive failed")
+	})
+	RegisterChainDerive(t, "chain-invalid", func(result []byte) (any, error) {
+		return "nope", nil
+	})
+
+	ti, err := first.Send([]int{1, 2}, SendWithFollowUps(
+		FollowUp{Queue: "total", Derive: "chain-broken"},
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, OutcomeRetrying, first.ExecuteTask(ti).Outcome)
+	retry, err := first.FindTaskInstance(StatePending, ti.id)
+	assert.Nil(t, err)
+	result := first.ExecuteTask(retry)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+	assert.ErrorContains(t, result.Error, "derive failed")
+	failed, err := first.FindTaskInstance(StateFailed, ti.id)
+	assert.Nil(t, err)
+	assert.False(t, failed.IsLocked())
+
+	// the result of the task is kept all the same.
+	data, err := first.GetResult(ti.id)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"sum": 3}`, string(data))
+
+	// derived args the executor rejects are not retried.
+	ti, err = first.Send([]int{1, 2}, SendWithFollowUps(
+		FollowUp{Queue: "total", Derive: "chain-invalid"},
+	))
+	assert.Nil(t, err)
+	result = first.ExecuteTask(ti)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+	assert.ErrorContains(t, result.Error, "invalid total follow up task options")
+
+	pending, err := second.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pending))
+}
+
+func TestTaskQueue_FollowUpsRetriedWithoutRetryPolicy(t *testing.T) {
+	_, second := MakeChainQueues(t)
+	RegisterChainDerive(t, "chain-broken", func(result []byte) (any, error) {
+		return nil, errors.New("derive failed")
+	})
+
+	// the follow ups of a queue that does not retry are
+	// retried rather than dead-lettering the task.
+	ti, err := second.Send([]int{1, 2}, SendWithFollowUps(
+		FollowUp{Queue: "total", Derive: "chain-broken"},
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, OutcomeRetrying, second.ExecuteTask(ti).Outcome)
+	retry, err := second.FindTaskInstance(StatePending, ti.id)
+	assert.Nil(t, err)
+	_, ok := retry.DueAt()
+	assert.True(t, ok)
+	assert.False(t, retry.isDue())
+}
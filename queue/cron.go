@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a periodic task instance is sent.
+type Schedule interface {
+	// Next returns the first time after t the schedule fires,
+	// or the zero time if it never fires again.
+	Next(t time.Time) time.Time
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Every returns a Schedule that fires every interval, which is
+// rounded to a whole second.
+func Every(interval time.Duration) Schedule {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return intervalSchedule{interval: interval.Round(time.Second)}
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Truncate(time.Second).Add(s.interval)
+}
+
+// cronSchedule holds a bit set of the accepted values of each field.
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// anyDay is true if either day field is a *, in which case
+	// only the other one is checked. Otherwise a day matches
+	// when either of them does.
+	anyDay bool
+}
+
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard five field cron expression: minute,
+// hour, day of month, month and day of week. Fields accept *, single
+// values, ranges, lists and /steps. The @hourly, @daily, @weekly,
+// @monthly and @yearly macros are understood, as is "@every 5m".
+// Times are matched in the location of the time passed to Next.
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if interval, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		return Every(d), nil
+	}
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected %d fields", expr, len(cronFields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		bits[i], err = parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	// sunday is both 0 and 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDay: fields[2] == "*" || fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s", stepStr, spec.name)
+			}
+		}
+		start, end := spec.min, spec.max
+		if rng != "*" {
+			lo, hi, isRange := strings.Cut(rng, "-")
+			var err error
+			start, err = strconv.Atoi(lo)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s", lo, spec.name)
+			}
+			end = start
+			if isRange {
+				end, err = strconv.Atoi(hi)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s", hi, spec.name)
+				}
+			} else if hasStep {
+				end = spec.max
+			}
+		}
+		if start < spec.min || end > spec.max || start > end {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", spec.name, part, spec.min, spec.max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// every combination of fields comes around within a few years,
+	// so give up on expressions like "0 0 30 2 *" that never match.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s cronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
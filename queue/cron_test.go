@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	// a wednesday.
+	start := time.Date(2024, 1, 10, 10, 17, 30, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2024, 1, 10, 11, 5, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 10, 13, 0, 0, 0, time.UTC)},
+		{"30 8 * * 1-5", time.Date(2024, 1, 11, 8, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		// either day field matches when both are restricted.
+		{"0 0 1 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, 1, 10, 10, 19, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.expr)
+		assert.Nil(t, err, c.expr)
+		assert.Equal(t, c.next, schedule.Next(start), c.expr)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every soon",
+	} {
+		_, err := ParseCron(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	start := time.Date(2024, 1, 10, 10, 17, 30, 500, time.UTC)
+	assert.Equal(t, start.Add(time.Hour).Truncate(time.Second), Every(time.Hour).Next(start))
+	assert.Equal(t, time.Date(2024, 1, 10, 10, 17, 31, 0, time.UTC), Every(0).Next(start))
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"fmt"
+)
+
+// DeadLetter is a task instance that has permanently failed, along
+// with everything that was recorded about it.
+type DeadLetter struct {
+	Instance TaskInstance
+	Data     []byte
+	Meta     TaskMeta
+	Errors   TaskErrors
+}
+
+// DeadLetters returns the task instances in the queue's dead-letter
+// area: the failed state directory, where an instance lands once its
+// retries are exhausted, or on its first failure without a retry policy.
+func (tq TaskQueue) DeadLetters() ([]TaskInstance, error) {
+	return tq.GetTaskInstancesIn(StateFailed)
+}
+
+// DeadLetter returns the dead-lettered task instance with the given id.
+func (tq TaskQueue) DeadLetter(id string) (TaskInstance, error) {
+	return tq.FindTaskInstance(StateFailed, id)
+}
+
+// InspectDeadLetter reads the task arguments, meta and
+// error history of the dead-lettered task instance id.
+func (tq TaskQueue) InspectDeadLetter(id string) (DeadLetter, error) {
+	letter := DeadLetter{}
+	instance, err := tq.DeadLetter(id)
+	if err != nil {
+		return letter, err
+	}
+	letter.Instance = instance
+	letter.Data, err = instance.TaskFile().Read()
+	if err != nil {
+		return letter, err
+	}
+	letter.Meta, err = instance.GetMeta()
+	if err != nil {
+		return letter, err
+	}
+	letter.Errors, err = instance.GetHistory()
+	return letter, err
+}
+
+// RequeueDeadLetter moves the dead-lettered task instance id back
+// into pending. Its errors are archived into the task history, so
+// it is ready at once and gets a fresh set of retry attempts.
+func (tq TaskQueue) RequeueDeadLetter(id string) (TaskInstance, error) {
+	instance, err := tq.DeadLetter(id)
+	if err != nil {
+		return instance, err
+	}
+	return instance.Reset(true)
+}
+
+// PurgeDeadLetter deletes the dead-lettered task instance id.
+func (tq TaskQueue) PurgeDeadLetter(id string) error {
+	instance, err := tq.DeadLetter(id)
+	if err != nil {
+		return err
+	}
+	return instance.Remove()
+}
+
+// PurgeDeadLetters deletes every dead-lettered task instance
+// of the queue and returns how many were removed.
+func (tq TaskQueue) PurgeDeadLetters() (int, error) {
+	instances, err := tq.DeadLetters()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, instance := range instances {
+		err = instance.Remove()
+		if err != nil {
+			return purged, fmt.Errorf("purge %s: %w", instance.id, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
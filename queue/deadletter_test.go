@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func MakeDeadLetter(t *testing.T) (*TaskQueue, TaskInstance) {
+	tq := MakeTaskQueue(true)
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+	return tq, ti
+}
+
+func TestTaskQueue_DeadLetters(t *testing.T) {
+	tq, ti := MakeDeadLetter(t)
+
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pending))
+
+	letters, err := tq.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(letters))
+	assert.Equal(t, ti.id, letters[0].id)
+
+	_, err = tq.DeadLetter("missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTaskQueue_InspectDeadLetter(t *testing.T) {
+	tq, ti := MakeDeadLetter(t)
+
+	letter, err := tq.InspectDeadLetter(ti.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StateFailed, letter.Instance.State())
+	assert.JSONEq(t, `{"id": 1, "name": "Hello!"}`, string(letter.Data))
+	assert.Equal(t, 1, letter.Errors.Count())
+	assert.Equal(t, "ConcreteTask 1 failed", letter.Errors.Errors[0].Error)
+}
+
+func TestTaskQueue_RequeueDeadLetter(t *testing.T) {
+	tq, ti := MakeDeadLetter(t)
+
+	requeued, err := tq.RequeueDeadLetter(ti.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatePending, requeued.State())
+	assert.False(t, requeued.HasError())
+	assert.True(t, requeued.IsReady())
+
+	// the errors survive as history and keep growing.
+	result := tq.ExecuteTask(requeued)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+	letter, err := tq.InspectDeadLetter(ti.id)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, letter.Errors.Count())
+
+	_, err = tq.RequeueDeadLetter("missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTaskQueue_PurgeDeadLetters(t *testing.T) {
+	tq, ti := MakeDeadLetter(t)
+
+	err := tq.PurgeDeadLetter(ti.id)
+	assert.Nil(t, err)
+	letters, err := tq.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(letters))
+
+	for id := 1; id <= 3; id++ {
+		ti, err := tq.Send(TaskOptions{Id: id, Name: "Hello!"})
+		assert.Nil(t, err)
+		tq.ExecuteTask(ti)
+	}
+	purged, err := tq.PurgeDeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, purged)
+	letters, err = tq.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(letters))
+}
@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrDuplicateTask is returned by Send when a task instance with
+// the same idempotency key is pending or running, or finished within
+// the queue's dedupe window. The existing instance is returned with it.
+var ErrDuplicateTask = errors.New("duplicate task")
+
+// keysDir holds a record of the task instance last sent with each
+// idempotency key, along with a lock file serialising its senders.
+const keysDir = "keys"
+
+type taskKey struct {
+	Id       string    `json:"id"`
+	Dir      string    `json:"dir"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// argsKey derives an idempotency key from serialized task arguments.
+func argsKey(serializedTaskArgs []byte) string {
+	sum := sha256.Sum256(serializedTaskArgs)
+	return hex.EncodeToString(sum[:])
+}
+
+// keyName returns the name the files of key are stored under.
+func keyName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (tq TaskQueue) keyPath(name string, suffix string) Path {
+	return tq.root.Join(keysDir, name+suffix)
+}
+
+// lockKey takes the lock of the key stored as name, which every
+// process sending or finishing a task instance with that key, or
+// purging its record, has to hold.
+func (tq TaskQueue) lockKey(name string) (*FileLock, error) {
+	lockFile := tq.keyPath(name, ".lock")
+	lock := NewFileLock(lockFile.fs, lockFile.String())
+	err := lock.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (tq TaskQueue) readKey(name string) (taskKey, bool, error) {
+	record := taskKey{}
+	keyFile := tq.keyPath(name, ".json")
+	if !keyFile.Exists() {
+		return record, false, nil
+	}
+	data, err := keyFile.Read()
+	if err != nil {
+		return record, false, err
+	}
+	err = json.Unmarshal(data, &record)
+	return record, err == nil, err
+}
+
+func (tq TaskQueue) writeKey(name string, record taskKey) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return tq.keyPath(name, ".json").Write(data)
+}
+
+// sendUnique sends a task instance unless the instance last sent
+// with the same key is still pending or running, or finished within
+// the dedupe window.
+func (tq TaskQueue) sendUnique(serializedTaskArgs []byte, meta TaskMeta) (TaskInstance, error) {
+	name := keyName(meta.Key)
+	lock, err := tq.lockKey(name)
+	if err != nil {
+		return TaskInstance{}, err
+	}
+	defer lock.Release()
+
+	record, ok, err := tq.readKey(name)
+	if err != nil {
+		return TaskInstance{}, err
+	}
+	if ok {
+		existing, found := tq.duplicateOf(record)
+		if found {
+			return existing, fmt.Errorf("%w: %s", ErrDuplicateTask, existing.id)
+		}
+	}
+
+	ti, err := tq.send(serializedTaskArgs, meta)
+	if err != nil {
+		return ti, err
+	}
+	return ti, tq.writeKey(name, taskKey{Id: ti.id, Dir: ti.root.Name()})
+}
+
+// duplicateOf returns the task instance of record if it
+// still blocks another instance with the same key.
+func (tq TaskQueue) duplicateOf(record taskKey) (TaskInstance, bool) {
+	for _, state := range []TaskState{StatePending, StateRunning} {
+		dir := tq.StateDir(state).Join(record.Dir)
+		if dir.Exists() {
+			return tq.LoadTaskInstance(dir), true
+		}
+	}
+	if record.Finished.IsZero() || time.Since(record.Finished) >= tq.opts.DedupeWindow {
+		return TaskInstance{}, false
+	}
+	for _, state := range []TaskState{StateDone, StateFailed} {
+		dir := tq.StateDir(state).Join(record.Dir)
+		if dir.Exists() {
+			return tq.LoadTaskInstance(dir), true
+		}
+	}
+	return TaskInstance{}, false
+}
+
+// finishKey records that the instance sent with an idempotency
+// key has finished, which starts its dedupe window.
+func (tq TaskQueue) finishKey(instance TaskInstance) error {
+	meta, err := instance.GetMeta()
+	if err != nil || meta.Key == "" {
+		return err
+	}
+	name := keyName(meta.Key)
+	lock, err := tq.lockKey(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	record, ok, err := tq.readKey(name)
+	if err != nil || !ok || record.Id != instance.id {
+		return err
+	}
+	record.Finished = time.Now()
+	return tq.writeKey(name, record)
+}
+
+// PurgeKeys deletes the records of the idempotency keys that no
+// longer hold back a task instance: the instance last sent with the
+// key finished longer ago than the dedupe window, or is gone. It
+// returns how many were deleted.
+func (tq TaskQueue) PurgeKeys() (int, error) {
+	files, err := tq.root.Join(keysDir).ReadDir()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	var errs []error
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok {
+			continue
+		}
+		ok, err = tq.purgeKey(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("purge key %s: %w", name, err))
+			continue
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, errors.Join(errs...)
+}
+
+func (tq TaskQueue) purgeKey(name string) (bool, error) {
+	lock, err := tq.lockKey(name)
+	if err != nil {
+		return false, err
+	}
+	defer lock.Release()
+
+	record, ok, err := tq.readKey(name)
+	if err != nil || !ok {
+		return false, err
+	}
+	_, found := tq.duplicateOf(record)
+	if found {
+		return false, nil
+	}
+	err = tq.keyPath(name, ".json").Remove()
+	if err != nil {
+		return false, err
+	}
+	// removed while it is held, so a sender waiting
+	// on it starts over with a fresh lock file.
+	return true, tq.keyPath(name, ".lock").Remove()
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaskQueue_SendWithKey(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	first, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("report"))
+	assert.Nil(t, err)
+	meta, err := first.GetMeta()
+	assert.Nil(t, err)
+	assert.Equal(t, "report", meta.Key)
+
+	// refused while pending, whatever the arguments.
+	dup, err := tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendWithKey("report"))
+	assert.ErrorIs(t, err, ErrDuplicateTask)
+	assert.Equal(t, first.id, dup.id)
+	_, err = tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("other"))
+	assert.Nil(t, err)
+
+	// without a dedupe window, it can be sent again once finished.
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(first).Outcome)
+	second, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("report"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.id, second.id)
+}
+
+func TestTaskQueue_SendUnique(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	first, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendUnique())
+	assert.Nil(t, err)
+	dup, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendUnique())
+	assert.ErrorIs(t, err, ErrDuplicateTask)
+	assert.Equal(t, first.id, dup.id)
+	_, err = tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendUnique())
+	assert.Nil(t, err)
+
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pending))
+}
+
+func TestTaskQueue_DedupeWindow(t *testing.T) {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{Errored: true},
+		WithDedupeWindow(100*time.Millisecond),
+	)
+	assert.Nil(t, err)
+
+	first, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendUnique())
+	assert.Nil(t, err)
+	assert.Equal(t, OutcomeFailed, tq.ExecuteTask(first).Outcome)
+
+	// a dead letter counts as finished, and holds off
+	// duplicates for the length of the window.
+	dup, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendUnique())
+	assert.ErrorIs(t, err, ErrDuplicateTask)
+	assert.Equal(t, StateFailed, dup.State())
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendUnique())
+	assert.Nil(t, err)
+}
+
+func TestTaskQueue_PurgeKeys(t *testing.T) {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{},
+		WithDedupeWindow(50*time.Millisecond),
+	)
+	assert.Nil(t, err)
+
+	first, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("first"))
+	assert.Nil(t, err)
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(first).Outcome)
+	_, err = tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendWithKey("second"))
+	assert.Nil(t, err)
+
+	// kept within the window, and while pending.
+	purged, err := tq.PurgeKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+
+	time.Sleep(80 * time.Millisecond)
+	purged, err = tq.PurgeKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	files, err := tq.root.Join(keysDir).ReadDir()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files))
+
+	_, err = tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("first"))
+	assert.Nil(t, err)
+	_, err = tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendWithKey("second"))
+	assert.ErrorIs(t, err, ErrDuplicateTask)
+}
+
+func TestTaskQueue_SendWithKeyConcurrent(t *testing.T) {
+	root := t.TempDir()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sent := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every sender has a queue of its own, as
+			// separate processes would.
+			tq, err := NewTaskQueue(NewPath(root, afero.NewOsFs(), 0777), "concrete", &ConcreteTask{})
+			if !assert.Nil(t, err) {
+				return
+			}
+			_, err = tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("once"))
+			if err == nil {
+				mu.Lock()
+				sent++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, ErrDuplicateTask)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, sent)
+
+	tq, err := NewTaskQueue(NewPath(root, afero.NewOsFs(), 0777), "concrete", &ConcreteTask{})
+	assert.Nil(t, err)
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+}
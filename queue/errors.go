@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// ErrTaskPanicked is matched by the error recorded for a
+// task executor that panicked.
+var ErrTaskPanicked = errors.New("task panicked")
+
+// StackTracer is implemented by errors that carry the stack they
+// were created on. When an executor returns one, its stack trace
+// is recorded as the traceback in the task error file.
+type StackTracer interface {
+	StackTrace() string
+}
+
+// PanicError is returned in place of the panic of a task
+// executor, along with the stack of the panicking goroutine.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrTaskPanicked, e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return ErrTaskPanicked
+}
+
+func (e *PanicError) StackTrace() string {
+	return string(e.Stack)
+}
+
+// recoverPanic turns a panic into a PanicError assigned to err.
+// It must be deferred directly by the function it recovers.
+func recoverPanic(err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	*err = &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// traceback returns the stack trace carried by err, if any.
+func traceback(err error) string {
+	var tracer StackTracer
+	if errors.As(err, &tracer) {
+		return tracer.StackTrace()
+	}
+	return ""
+}
+
+// ErrorKind classifies a task execution error by what
+// was done with the task instance because of it.
+type ErrorKind string
+
+const (
+	// ErrorTransient errors are retried as the queue's retry policy allows.
+	ErrorTransient ErrorKind = "transient"
+	// ErrorPermanent errors dead-letter the task instance at once.
+	ErrorPermanent ErrorKind = "permanent"
+	// ErrorRetryAfter errors reschedule the task instance after a delay.
+	ErrorRetryAfter ErrorKind = "retry_after"
+	// ErrorSkip errors finish the task instance without it failing.
+	ErrorSkip ErrorKind = "skip"
+	// ErrorExpired records that the task instance expired before
+	// it was executed, and was moved into expired.
+	ErrorExpired ErrorKind = "expired"
+	// ErrorCancelled records that the task instance was
+	// cancelled, and was moved into cancelled.
+	ErrorCancelled ErrorKind = "cancelled"
+)
+
+// PermanentError marks an error that retrying cannot fix,
+// such as a bad payload.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps err so the task instance is
+// dead-lettered without being retried.
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return errorMessage(e.Err, "permanent error")
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterError marks an error that is expected to
+// clear up once Delay has passed.
+type RetryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+// RetryAfter wraps err so the task instance is retried after delay,
+// in place of the retry policy's backoff. The task instance is
+// rescheduled even without a retry policy, but a policy's
+// MaxAttempts still dead-letters it once reached.
+func RetryAfter(err error, delay time.Duration) error {
+	return &RetryAfterError{Err: err, Delay: delay}
+}
+
+func (e *RetryAfterError) Error() string {
+	return errorMessage(e.Err, fmt.Sprintf("retry after %s", e.Delay))
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// SkipError marks a task instance that there is no point in
+// executing, such as one whose work has already been done.
+type SkipError struct {
+	Err error
+}
+
+// Skip wraps err so the task instance is moved to done without
+// counting as a failure. err is kept in its error file as the reason.
+func Skip(err error) error {
+	return &SkipError{Err: err}
+}
+
+func (e *SkipError) Error() string {
+	return errorMessage(e.Err, "task skipped")
+}
+
+func (e *SkipError) Unwrap() error {
+	return e.Err
+}
+
+func errorMessage(err error, fallback string) string {
+	if err == nil {
+		return fallback
+	}
+	return err.Error()
+}
+
+// classify returns the kind of err and, for ErrorRetryAfter, its delay.
+func classify(err error) (ErrorKind, time.Duration) {
+	var permanent *PermanentError
+	var retryAfter *RetryAfterError
+	var skip *SkipError
+	switch {
+	case errors.As(err, &skip):
+		return ErrorSkip, 0
+	case errors.As(err, &permanent):
+		return ErrorPermanent, 0
+	case errors.As(err, &retryAfter):
+		return ErrorRetryAfter, retryAfter.Delay
+	default:
+		return ErrorTransient, 0
+	}
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// PanicTask panics, or returns err if one is set.
+type PanicTask struct {
+	err error
+}
+
+func (t PanicTask) Assert(opt any) error {
+	return nil
+}
+
+func (t PanicTask) Execute(jsonData []byte) error {
+	if t.err != nil {
+		return t.err
+	}
+	panic("PanicTask exploded")
+}
+
+type tracedError struct {
+	msg string
+}
+
+func (e tracedError) Error() string {
+	return e.msg
+}
+
+func (e tracedError) StackTrace() string {
+	return "main.go:42"
+}
+
+func MakePanicQueue(t *testing.T, task PanicTask, opts ...QueueOption) TaskQueue {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"panic",
+		task,
+		opts...,
+	)
+	assert.Nil(t, err)
+	return tq
+}
+
+func TestTaskQueue_ExecuteTaskPanic(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Minute} {
+		tq := MakePanicQueue(t, PanicTask{}, WithTimeout(timeout))
+		ti, err := tq.Send(nil)
+		assert.Nil(t, err)
+
+		result := tq.ExecuteTask(ti)
+		assert.Equal(t, OutcomeFailed, result.Outcome)
+		assert.ErrorIs(t, result.Error, ErrTaskPanicked)
+		assert.EqualError(t, result.Error, "task panicked: PanicTask exploded")
+
+		failed, err := tq.DeadLetter(ti.id)
+		assert.Nil(t, err)
+		taskErrors, err := failed.GetErrors()
+		assert.Nil(t, err)
+		last, ok := taskErrors.Last()
+		assert.True(t, ok)
+		assert.Equal(t, "task panicked: PanicTask exploded", last.Error)
+		assert.Contains(t, last.Traceback, "PanicTask.Execute")
+	}
+}
+
+func TestTaskQueue_ExecuteTaskStackTrace(t *testing.T) {
+	err := tracedError{msg: "bad input"}
+	tq := MakePanicQueue(t, PanicTask{err: err})
+	ti, sendErr := tq.Send(nil)
+	assert.Nil(t, sendErr)
+
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+
+	failed, _ := tq.DeadLetter(ti.id)
+	taskErrors, _ := failed.GetErrors()
+	last, _ := taskErrors.Last()
+	assert.Equal(t, "main.go:42", last.Traceback)
+
+	// wrapped errors keep their stack trace, plain ones have none.
+	assert.Equal(t, "main.go:42", traceback(errors.Join(errors.New("context"), err)))
+	assert.Equal(t, "", traceback(errors.New("plain")))
+}
+
+func TestClassify(t *testing.T) {
+	err := errors.New("bad payload")
+
+	kind, _ := classify(err)
+	assert.Equal(t, ErrorTransient, kind)
+	kind, _ = classify(Permanent(err))
+	assert.Equal(t, ErrorPermanent, kind)
+	kind, _ = classify(Skip(err))
+	assert.Equal(t, ErrorSkip, kind)
+	kind, delay := classify(fmt.Errorf("wrapped: %w", RetryAfter(err, time.Minute)))
+	assert.Equal(t, ErrorRetryAfter, kind)
+	assert.Equal(t, time.Minute, delay)
+
+	assert.ErrorIs(t, Permanent(err), err)
+	assert.EqualError(t, Permanent(err), "bad payload")
+	assert.EqualError(t, Permanent(nil), "permanent error")
+	assert.EqualError(t, RetryAfter(nil, time.Second), "retry after 1s")
+	assert.EqualError(t, Skip(nil), "task skipped")
+}
+
+func TestTaskQueue_ExecuteTaskPermanent(t *testing.T) {
+	tq := MakePanicQueue(t, PanicTask{err: Permanent(errors.New("bad payload"))},
+		WithRetry(RetryPolicy{MaxAttempts: 5}))
+	ti, err := tq.Send(nil)
+	assert.Nil(t, err)
+
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+	failed, err := tq.DeadLetter(ti.id)
+	assert.Nil(t, err)
+	taskErrors, _ := failed.GetErrors()
+	last, _ := taskErrors.Last()
+	assert.Equal(t, ErrorPermanent, last.Kind)
+	assert.Equal(t, "bad payload", last.Error)
+}
+
+func TestTaskQueue_ExecuteTaskRetryAfter(t *testing.T) {
+	tq := MakePanicQueue(t, PanicTask{err: RetryAfter(errors.New("rate limited"), time.Hour)})
+	ti, err := tq.Send(nil)
+	assert.Nil(t, err)
+
+	// rescheduled even though the queue has no retry policy.
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeRetrying, result.Outcome)
+	assert.False(t, ti.IsReady())
+	retryAt, ok := ti.RetryAt()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), retryAt, time.Minute)
+	taskErrors, _ := ti.GetErrors()
+	last, _ := taskErrors.Last()
+	assert.Equal(t, ErrorRetryAfter, last.Kind)
+
+	// a retry policy still limits the attempts.
+	tq = MakePanicQueue(t, PanicTask{err: RetryAfter(errors.New("rate limited"), 0)},
+		WithRetry(RetryPolicy{MaxAttempts: 2}))
+	ti, err = tq.Send(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, OutcomeRetrying, tq.ExecuteTask(ti).Outcome)
+	assert.Equal(t, OutcomeFailed, tq.ExecuteTask(ti).Outcome)
+}
+
+func TestTaskQueue_ExecuteTaskSkip(t *testing.T) {
+	tq := MakePanicQueue(t, PanicTask{err: Skip(errors.New("already sent"))},
+		WithRetry(RetryPolicy{MaxAttempts: 5}))
+	ti, err := tq.Send(nil)
+	assert.Nil(t, err)
+
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeSkipped, result.Outcome)
+	done, err := tq.GetTaskInstancesIn(StateDone)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(done))
+	taskErrors, _ := done[0].GetErrors()
+	last, _ := taskErrors.Last()
+	assert.Equal(t, ErrorSkip, last.Kind)
+	assert.Equal(t, "already sent", last.Error)
+}
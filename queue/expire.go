@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTaskExpired is recorded for a task instance that
+// expired before it was executed.
+var ErrTaskExpired = errors.New("task expired")
+
+// ExpiresAt returns the time the task expires at. It is
+// false if the task was sent without an expiry.
+func (ti TaskInstance) ExpiresAt() (time.Time, bool) {
+	meta, err := ti.GetMeta()
+	if err != nil || meta.ExpiresAt.IsZero() {
+		return time.Time{}, false
+	}
+	return meta.ExpiresAt, true
+}
+
+// IsExpired is true once the expiry time of the task has passed.
+func (ti TaskInstance) IsExpired() bool {
+	expiresAt, ok := ti.ExpiresAt()
+	return ok && !time.Now().Before(expiresAt)
+}
+
+// expire records why the claimed instance was not executed
+// in its error file and moves it into expired.
+func (tq TaskQueue) expire(instance *TaskInstance) error {
+	expiresAt, _ := instance.ExpiresAt()
+	err := instance.AddError(TaskExecutionError{
+		Timestamp: time.Now(),
+		Error:     fmt.Sprintf("%s at %s", ErrTaskExpired, expiresAt.Format(time.RFC3339)),
+		Kind:      ErrorExpired,
+	})
+	if err != nil {
+		return err
+	}
+	*instance, err = instance.MoveTo(StateExpired)
+	if err != nil {
+		return err
+	}
+	return tq.finishKey(*instance)
+}
+
+// ExpireTaskInstances moves the expired pending task instances of
+// the queue into expired and returns them. Instances claimed by
+// somebody else meanwhile are left to them.
+func (tq TaskQueue) ExpireTaskInstances() ([]TaskInstance, error) {
+	expired := []TaskInstance{}
+	tasks, err := tq.GetTaskInstances()
+	if err != nil {
+		return expired, err
+	}
+	var errs []error
+	for _, task := range tasks {
+		if !task.IsExpired() {
+			continue
+		}
+		claimed, err := task.Claim()
+		if errors.Is(err, ErrTaskLocked) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = tq.expire(&claimed)
+		if err == nil {
+			expired = append(expired, claimed)
+		} else {
+			errs = append(errs, err)
+		}
+		err = claimed.ReleaseLock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return expired, errors.Join(errs...)
+}
@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTaskQueue_ExecuteTaskExpired(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithExpiry(time.Now().Add(-time.Second)))
+	assert.Nil(t, err)
+	assert.True(t, ti.IsExpired())
+
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeExpired, result.Outcome)
+	task := InterfaceToType[ConcreteTask](tq.Task(), ConcreteTask{})
+	assert.False(t, task.Executed)
+
+	expired, err := tq.GetTaskInstancesIn(StateExpired)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(expired))
+	taskErrors, err := expired[0].GetErrors()
+	assert.Nil(t, err)
+	last, _ := taskErrors.Last()
+	assert.Equal(t, ErrorExpired, last.Kind)
+	assert.Contains(t, last.Error, "task expired at")
+}
+
+func TestTaskQueue_TTL(t *testing.T) {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{},
+		WithTTL(time.Hour),
+	)
+	assert.Nil(t, err)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	expiresAt, ok := ti.ExpiresAt()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+	assert.False(t, ti.IsExpired())
+
+	// an expiry given at send wins over the queue's.
+	ti, err = tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendWithTTL(10*time.Millisecond))
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, ti.IsExpired())
+}
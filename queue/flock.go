@@ -0,0 +1,281 @@
+// This flock version has been poached and altered from https://github.com/hashicorp/vic/blob/v1.5.0/pkg/filelock/flock.go
+
+// Copyright 2016-2017 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrLocked is returned when a lock is already held by another owner.
+var ErrLocked = errors.New("lock is held by another owner")
+
+// fder is implemented by file handles backed by a real OS file
+// descriptor (i.e. *os.File returned from afero.OsFs).
+type fder interface {
+	Fd() uintptr
+}
+
+// FileLock is a cross-process lock designed to work over FS that supports locking.
+// On unix systems files opened through an OS backed afero.Fs are locked with an
+// advisory flock(2). Any other file (e.g. afero.MemMapFs) falls back to an
+// in-process lock keyed by the file system and file name.
+type FileLock struct {
+	LockFile string
+	fs       afero.Fs
+	mu       sync.Mutex
+	fh       afero.File
+}
+
+// NewFileLock returns a new instance of the file based lock.
+// it is a user responsibility to ensure lock name is unique and doesn't collide
+// with any other file names in the TEMP directory.
+func NewFileLock(fs afero.Fs, lockFile string) *FileLock {
+	return &FileLock{
+		LockFile: lockFile,
+		fs:       fs,
+	}
+}
+
+// Acquire grabs the lock. If lock is already acquired, it will block.
+// User should check for errors if lock is actually acquired, if lock is not acquired
+// it will panic on Release.
+func (fl *FileLock) Acquire() error {
+	fl.mu.Lock()
+	for {
+		err := fl.lock(true)
+		if err == nil {
+			return nil
+		}
+		// the file we were waiting on was removed by its previous
+		// owner, so start over with a fresh file.
+		if errors.Is(err, errStaleLockFile) {
+			continue
+		}
+		fl.mu.Unlock()
+		return err
+	}
+}
+
+// TryAcquire grabs the lock without blocking. If the lock is held by
+// another owner - in this process or any other - ErrLocked is returned.
+func (fl *FileLock) TryAcquire() error {
+	if !fl.mu.TryLock() {
+		return ErrLocked
+	}
+	err := fl.lock(false)
+	if errors.Is(err, errStaleLockFile) {
+		err = ErrLocked
+	}
+	if err != nil {
+		fl.mu.Unlock()
+	}
+	return err
+}
+
+// Release lock. If lock is not acquired, it will panic.
+func (fl *FileLock) Release() error {
+	if fl.fh == nil {
+		panic("Attempt to release not acquired lock!")
+	}
+	// #nosec: Errors unhandled
+	_ = unlockFile(fl.fs, fl.fh)
+	err := fl.fh.Close()
+	fl.fh = nil
+	fl.mu.Unlock()
+	return err
+}
+
+// File returns the handle of the acquired lock file, or nil
+// if the lock is not held.
+//
+//nolint:ireturn
+func (fl *FileLock) File() afero.File {
+	return fl.fh
+}
+
+var errStaleLockFile = errors.New("lock file was removed while waiting")
+
+func (fl *FileLock) lock(block bool) error {
+	fh, err := openLockFile(fl.fs, fl.LockFile)
+	if err != nil {
+		return err
+	}
+	err = lockFile(fl.fs, fh, block)
+	if err != nil {
+		// #nosec: Errors unhandled
+		fh.Close()
+		return err
+	}
+	// the previous owner may have removed the lock file between our
+	// open and lock, in which case we hold a lock nobody else can see.
+	if !sameFile(fl.fs, fh, fl.LockFile) {
+		_ = unlockFile(fl.fs, fh)
+		// #nosec: Errors unhandled
+		fh.Close()
+		return errStaleLockFile
+	}
+	fl.fh = fh
+	return nil
+}
+
+// openLockFile opens the lock file, creating it if needed. afero.MemMapFs
+// happily creates files in missing directories, so there the parent is
+// checked under renameMu so a directory that was just moved away is not
+// brought back to life.
+//
+//nolint:ireturn
+func openLockFile(fs afero.Fs, name string) (afero.File, error) {
+	if isOsFs(fs) {
+		return fs.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o666)
+	}
+	renameMu.Lock()
+	defer renameMu.Unlock()
+	ok, err := afero.DirExists(fs, filepath.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return fs.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o666)
+}
+
+// IsFileLocked is true if name exists and a lock on it is
+// currently held by any owner, including this process.
+func IsFileLocked(fs afero.Fs, name string) bool {
+	fh, err := fs.OpenFile(name, os.O_RDWR, 0o666)
+	if err != nil {
+		return false
+	}
+	defer fh.Close()
+	err = lockFile(fs, fh, false)
+	if err != nil {
+		return errors.Is(err, ErrLocked)
+	}
+	_ = unlockFile(fs, fh)
+	return false
+}
+
+func sameFile(fs afero.Fs, fh afero.File, name string) bool {
+	pathInfo, err := fs.Stat(name)
+	if err != nil {
+		return false
+	}
+	if f, ok := fh.(*mem.File); ok {
+		info, ok := pathInfo.(*mem.FileInfo)
+		return !ok || info.FileData == f.Data()
+	}
+	if _, ok := fh.(fder); !ok {
+		return true
+	}
+	handleInfo, err := fh.Stat()
+	if err != nil {
+		return false
+	}
+	return os.SameFile(handleInfo, pathInfo)
+}
+
+// memLocks is the in-process fallback used for files that have no
+// OS file descriptor to flock. An entry is kept only while its lock
+// is held or waited on.
+var memLocks = struct {
+	sync.Mutex
+	locks map[any]*memLock
+}{locks: make(map[any]*memLock)}
+
+// memLock is held by whoever sent into ch. refs counts
+// its holder and waiters.
+type memLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+type memLockKey struct {
+	fs   afero.Fs
+	name string
+}
+
+// memFileKey identifies the file behind fh. Files from afero.MemMapFs
+// are keyed by their data so that, like an inode, the lock follows
+// the file when it is renamed.
+func memFileKey(fs afero.Fs, fh afero.File) any {
+	if f, ok := fh.(*mem.File); ok {
+		return f.Data()
+	}
+	return memLockKey{fs: fs, name: fh.Name()}
+}
+
+// refMemLock returns the lock of key, counting a reference to it.
+func refMemLock(key any) *memLock {
+	memLocks.Lock()
+	defer memLocks.Unlock()
+	l, ok := memLocks.locks[key]
+	if !ok {
+		l = &memLock{ch: make(chan struct{}, 1)}
+		memLocks.locks[key] = l
+	}
+	l.refs++
+	return l
+}
+
+// unrefMemLock drops a reference to the lock of key,
+// forgetting the lock once nobody holds or waits on it.
+func unrefMemLock(key any, l *memLock) {
+	memLocks.Lock()
+	defer memLocks.Unlock()
+	l.refs--
+	if l.refs <= 0 && memLocks.locks[key] == l {
+		delete(memLocks.locks, key)
+	}
+}
+
+func lockMem(fs afero.Fs, fh afero.File, block bool) error {
+	key := memFileKey(fs, fh)
+	l := refMemLock(key)
+	if block {
+		l.ch <- struct{}{}
+		return nil
+	}
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	default:
+		unrefMemLock(key, l)
+		return ErrLocked
+	}
+}
+
+func unlockMem(fs afero.Fs, fh afero.File) error {
+	key := memFileKey(fs, fh)
+	memLocks.Lock()
+	l, ok := memLocks.locks[key]
+	memLocks.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case <-l.ch:
+		unrefMemLock(key, l)
+	default:
+	}
+	return nil
+}
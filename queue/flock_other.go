@@ -0,0 +1,17 @@
+//go:build !unix
+
+package queue
+
+import (
+	"github.com/spf13/afero"
+)
+
+// Without flock(2) every file falls back to the in-process lock.
+
+func lockFile(fs afero.Fs, fh afero.File, block bool) error {
+	return lockMem(fs, fh, block)
+}
+
+func unlockFile(fs afero.Fs, fh afero.File) error {
+	return unlockMem(fs, fh)
+}
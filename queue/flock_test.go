@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLock_MemFs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll("/locks", 0777)
+
+	lockA := NewFileLock(fs, "/locks/task.lock")
+	lockB := NewFileLock(fs, "/locks/task.lock")
+
+	assert.False(t, IsFileLocked(fs, "/locks/task.lock"))
+
+	err := lockA.TryAcquire()
+	assert.Nil(t, err)
+	assert.True(t, IsFileLocked(fs, "/locks/task.lock"))
+
+	err = lockB.TryAcquire()
+	assert.ErrorIs(t, err, ErrLocked)
+
+	err = lockA.Release()
+	assert.Nil(t, err)
+	assert.False(t, IsFileLocked(fs, "/locks/task.lock"))
+
+	err = lockB.TryAcquire()
+	assert.Nil(t, err)
+
+	// a waiter keeps the lock around until it has released it.
+	acquired := make(chan error)
+	go func() {
+		acquired <- lockA.Acquire()
+	}()
+	assert.Nil(t, lockB.Release())
+	assert.Nil(t, <-acquired)
+	assert.Nil(t, lockA.Release())
+
+	// nothing is left behind once nobody holds or waits on it.
+	fh, err := fs.Open("/locks/task.lock")
+	assert.Nil(t, err)
+	memLocks.Lock()
+	_, ok := memLocks.locks[memFileKey(fs, fh)]
+	memLocks.Unlock()
+	assert.False(t, ok)
+	assert.Nil(t, fh.Close())
+}
+
+func TestFileLock_OsFs(t *testing.T) {
+	fs := afero.NewOsFs()
+	lockFile := filepath.Join(t.TempDir(), "task.lock")
+
+	lockA := NewFileLock(fs, lockFile)
+	lockB := NewFileLock(fs, lockFile)
+
+	err := lockA.TryAcquire()
+	assert.Nil(t, err)
+	assert.True(t, IsFileLocked(fs, lockFile))
+
+	// a second open file description is refused, just as
+	// it would be for another process.
+	err = lockB.TryAcquire()
+	assert.ErrorIs(t, err, ErrLocked)
+
+	err = lockA.Release()
+	assert.Nil(t, err)
+	assert.False(t, IsFileLocked(fs, lockFile))
+
+	err = lockB.TryAcquire()
+	assert.Nil(t, err)
+	assert.Nil(t, lockB.Release())
+}
+
+func TestTaskInstance_ApplyLock(t *testing.T) {
+	root := NewPath(t.TempDir(), afero.NewOsFs(), 0777)
+	ti := TaskInstance{
+		root: root.Join("12345667"),
+		id:   "12345667",
+	}
+	err := ti.Initialize()
+	assert.Nil(t, err)
+	assert.True(t, ti.IsLocked())
+
+	// a second claim on the same instance is refused.
+	other := TaskInstance{
+		root: root.Join("12345667"),
+		id:   "12345667",
+	}
+	err = other.ApplyLock()
+	assert.ErrorIs(t, err, ErrTaskLocked)
+
+	err = ti.ReleaseLock()
+	assert.Nil(t, err)
+	assert.False(t, ti.IsLocked())
+	assert.False(t, ti.LockFile().Exists())
+
+	err = other.ApplyLock()
+	assert.Nil(t, err)
+
+	err = other.Remove()
+	assert.Nil(t, err)
+	assert.False(t, ti.Exists())
+}
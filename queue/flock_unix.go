@@ -0,0 +1,41 @@
+//go:build unix
+
+package queue
+
+import (
+	"errors"
+	"github.com/spf13/afero"
+	"syscall"
+)
+
+func lockFile(fs afero.Fs, fh afero.File, block bool) error {
+	f, ok := fh.(fder)
+	if !ok {
+		return lockMem(fs, fh, block)
+	}
+	how := syscall.LOCK_EX
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return ErrLocked
+		default:
+			return err
+		}
+	}
+}
+
+func unlockFile(fs afero.Fs, fh afero.File) error {
+	f, ok := fh.(fder)
+	if !ok {
+		return unlockMem(fs, fh)
+	}
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
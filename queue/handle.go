@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTaskFailed is returned by TaskHandle.Wait for a task
+// instance that ended up in failed.
+var ErrTaskFailed = errors.New("task failed")
+
+// handlePollInterval is how often TaskHandle.Wait looks
+// for the task instance to have finished.
+const handlePollInterval = 100 * time.Millisecond
+
+// TaskHandle follows a sent task instance through the state
+// directories of its queue. It only relies on what is on disk, so
+// it works in a producer that is not the process executing the task.
+type TaskHandle struct {
+	queue TaskQueue
+	id    string
+}
+
+// Handle returns a handle on the task instance id of the queue.
+func (tq TaskQueue) Handle(id string) TaskHandle {
+	return TaskHandle{queue: tq, id: id}
+}
+
+// Handle returns a handle on the task instance.
+func (ti TaskInstance) Handle() TaskHandle {
+	queue := TaskQueue{
+		root: ti.root.Parent().Parent(),
+		name: ti.name,
+	}
+	return queue.Handle(ti.id)
+}
+
+func (h TaskHandle) Id() string {
+	return h.id
+}
+
+// Instance returns the task instance wherever it currently is.
+func (h TaskHandle) Instance() (TaskInstance, error) {
+	return h.queue.Lookup(h.id)
+}
+
+// Status returns the status of the task instance.
+func (h TaskHandle) Status() (TaskStatus, error) {
+	return h.queue.GetStatus(h.id)
+}
+
+// Result returns the JSON result of the task instance once it has
+// succeeded, and ErrNoResult until then. See TaskQueue.GetResult.
+func (h TaskHandle) Result() ([]byte, error) {
+	return h.queue.GetResult(h.id)
+}
+
+// Errors returns every error recorded for the task instance,
+// including those archived when it was requeued.
+func (h TaskHandle) Errors() (TaskErrors, error) {
+	instance, err := h.Instance()
+	if err != nil {
+		return TaskErrors{}, err
+	}
+	return instance.GetHistory()
+}
+
+// Wait blocks until the task instance has finished, or ctx is done.
+// It returns nil once the instance is in done, and an error wrapping
+// ErrTaskFailed, ErrTaskExpired or ErrTaskCancelled, with the last error recorded for
+// it, if it did not succeed.
+func (h TaskHandle) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(handlePollInterval)
+	defer ticker.Stop()
+	for {
+		finished, err := h.finished()
+		if finished || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// finished is true once the task instance has a finished
+// status, along with the error it ended with.
+func (h TaskHandle) finished() (bool, error) {
+	instance, err := h.Instance()
+	if err != nil {
+		return false, err
+	}
+	var failure error
+	switch instance.Status() {
+	case StatusSucceeded:
+		return true, nil
+	case StatusFailed:
+		failure = ErrTaskFailed
+	case StatusExpired:
+		failure = ErrTaskExpired
+	case StatusCancelled:
+		failure = ErrTaskCancelled
+	default:
+		return false, nil
+	}
+	taskErrors, err := instance.GetErrors()
+	if err != nil {
+		return true, err
+	}
+	last, ok := taskErrors.Last()
+	if !ok {
+		return true, fmt.Errorf("%w: %s", failure, h.id)
+	}
+	return true, fmt.Errorf("%w: %s", failure, last.Error)
+}
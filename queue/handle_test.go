@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"context"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTaskHandle_Wait(t *testing.T) {
+	root := t.TempDir()
+
+	// the producer and the worker only share the root directory.
+	producer, err := NewResultTaskQueue(NewPath(root, afero.NewOsFs(), 0777), "sum", SumTask{})
+	assert.Nil(t, err)
+	worker, err := NewResultTaskQueue(NewPath(root, afero.NewOsFs(), 0777), "sum", SumTask{})
+	assert.Nil(t, err)
+
+	ti, err := producer.Send([]int{1, 2, 3})
+	assert.Nil(t, err)
+	handle := ti.Handle()
+	assert.Equal(t, ti.id, handle.Id())
+
+	status, err := handle.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPending, status)
+	_, err = handle.Result()
+	assert.ErrorIs(t, err, ErrNoResult)
+
+	// not finished before the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, handle.Wait(ctx), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		worker.ExecuteTask(worker.LoadTaskInstance(ti.TaskDir()))
+	}()
+	assert.Nil(t, handle.Wait(context.Background()))
+
+	status, err = handle.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, StatusSucceeded, status)
+	data, err := handle.Result()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"sum": 6}`, string(data))
+	taskErrors, err := handle.Errors()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, taskErrors.Count())
+}
+
+func TestTaskHandle_WaitFailed(t *testing.T) {
+	tq := MakeTaskQueue(true)
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	tq.ExecuteTask(ti)
+
+	handle := tq.Handle(ti.id)
+	err = handle.Wait(context.Background())
+	assert.ErrorIs(t, err, ErrTaskFailed)
+	assert.EqualError(t, err, "task failed: ConcreteTask 1 failed")
+	taskErrors, err := handle.Errors()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, taskErrors.Count())
+
+	expired, err := tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendWithTTL(-time.Second))
+	assert.Nil(t, err)
+	tq.ExecuteTask(expired)
+	assert.ErrorIs(t, expired.Handle().Wait(context.Background()), ErrTaskExpired)
+
+	_, err = tq.Handle("missing").Status()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorIs(t, tq.Handle("missing").Wait(context.Background()), os.ErrNotExist)
+}
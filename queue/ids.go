@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// task ids are ULIDs: a 48 bit millisecond timestamp followed by 80
+// random bits, written in 26 characters of Crockford's base32. They
+// sort in the order they were created, which within a process is
+// guaranteed by incrementing the random part when the clock has not
+// moved on since the previous id.
+const (
+	taskIdLen      = 26
+	taskIdAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var taskIds = struct {
+	sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}{}
+
+func newTaskId(now time.Time) string {
+	taskIds.Lock()
+	defer taskIds.Unlock()
+
+	ms := uint64(now.UnixMilli())
+	if ms > taskIds.ms {
+		taskIds.ms = ms
+		_, err := rand.Read(taskIds.entropy[:])
+		if err != nil {
+			panic(err)
+		}
+	} else if !incrementEntropy(&taskIds.entropy) {
+		// the random part ran out within a single
+		// millisecond, so borrow the next one.
+		taskIds.ms++
+	}
+	return encodeTaskId(taskIds.ms, taskIds.entropy)
+}
+
+func incrementEntropy(entropy *[10]byte) bool {
+	for i := len(entropy) - 1; i >= 0; i-- {
+		entropy[i]++
+		if entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeTaskId(ms uint64, entropy [10]byte) string {
+	id := make([]byte, taskIdLen)
+	// 10 characters of timestamp, the top two bits of which are unused.
+	for i := 9; i >= 0; i-- {
+		id[i] = taskIdAlphabet[ms&31]
+		ms >>= 5
+	}
+	// 16 characters of entropy, 5 bits at a time.
+	var bits uint64
+	var n uint
+	pos := 10
+	for _, b := range entropy {
+		bits = bits<<8 | uint64(b)
+		n += 8
+		for n >= 5 {
+			n -= 5
+			id[pos] = taskIdAlphabet[(bits>>n)&31]
+			pos++
+		}
+	}
+	return string(id)
+}
+
+// taskIdTime returns the time a ULID task id was created. It is
+// false for ids in an older format, such as 15 character nanoids.
+func taskIdTime(id string) (time.Time, bool) {
+	if len(id) != taskIdLen || id[0] > '7' {
+		return time.Time{}, false
+	}
+	var ms int64
+	for i := 0; i < 10; i++ {
+		v := indexTaskIdAlphabet(id[i])
+		if v < 0 {
+			return time.Time{}, false
+		}
+		ms = ms<<5 | int64(v)
+	}
+	for i := 10; i < taskIdLen; i++ {
+		if indexTaskIdAlphabet(id[i]) < 0 {
+			return time.Time{}, false
+		}
+	}
+	return time.UnixMilli(ms), true
+}
+
+func indexTaskIdAlphabet(c byte) int {
+	for i := 0; i < len(taskIdAlphabet); i++ {
+		if taskIdAlphabet[i] == c {
+			return i
+		}
+	}
+	return -1
+}
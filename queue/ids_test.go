@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewTaskId(t *testing.T) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = NewTaskId()
+	}
+	// ids created in the same millisecond still sort in order.
+	assert.True(t, sort.StringsAreSorted(ids))
+	for i := 1; i < len(ids); i++ {
+		assert.NotEqual(t, ids[i-1], ids[i])
+	}
+	assert.Equal(t, taskIdLen, len(ids[0]))
+}
+
+func TestTaskIdTime(t *testing.T) {
+	now := time.Date(2024, 1, 10, 10, 17, 30, 123000000, time.UTC)
+	id := encodeTaskId(uint64(now.UnixMilli()), [10]byte{1, 2, 3})
+	sentAt, ok := taskIdTime(id)
+	assert.True(t, ok)
+	assert.True(t, now.Equal(sentAt), sentAt)
+
+	sentAt, ok = taskIdTime(NewTaskId())
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), sentAt, time.Second)
+
+	// ids of earlier versions are accepted, but hold no time.
+	_, ok = taskIdTime("V1StGXR8_Z5jdHi")
+	assert.False(t, ok)
+	_, ok = taskIdTime("01HKUQ0Z8VXXXXXXXXXXXXXXXU")
+	assert.False(t, ok)
+}
+
+func TestEncodeTaskId(t *testing.T) {
+	assert.Equal(t, "00000000000000000000000000", encodeTaskId(0, [10]byte{}))
+	max := [10]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encodeTaskId(1<<48-1, max))
+	assert.False(t, incrementEntropy(&max))
+}
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultLeaseDuration is how long a claim on a task instance
+// is good for before the owning worker has to renew it.
+const DefaultLeaseDuration = 30 * time.Second
+
+// ErrLeaseLost is returned when a worker finds that the task it
+// was executing has been reclaimed from under it.
+var ErrLeaseLost = errors.New("task lease lost")
+
+// Lease is written to the lock file of a claimed task
+// instance to record who owns it and until when.
+type Lease struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Acquired time.Time `json:"acquired"`
+	Deadline time.Time `json:"deadline"`
+}
+
+func NewLease(duration time.Duration) Lease {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	return Lease{
+		PID:      os.Getpid(),
+		Hostname: hostname,
+		Acquired: now,
+		Deadline: now.Add(duration),
+	}
+}
+
+// Expired is true once the lease deadline has passed.
+func (l Lease) Expired() bool {
+	return time.Now().After(l.Deadline)
+}
+
+func writeLease(lock *FileLock, lease Lease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	fh := lock.File()
+	err = fh.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = fh.WriteAt(data, 0)
+	return err
+}
+
+// GetLease reads the lease from the task lock file.
+func (ti TaskInstance) GetLease() (Lease, error) {
+	lease := Lease{}
+	data, err := ti.LockFile().Read()
+	if err != nil {
+		return lease, err
+	}
+	err = json.Unmarshal(data, &lease)
+	return lease, err
+}
+
+// RenewLease pushes the deadline of the lease held by this
+// process out to duration from now. ErrLeaseLost is returned if
+// the task has been reclaimed since it was locked.
+func (ti TaskInstance) RenewLease(duration time.Duration) error {
+	lock := ti.heldLock()
+	if lock == nil || !ti.OwnsLock() {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, ti.id)
+	}
+	lease, err := ti.GetLease()
+	if err != nil {
+		lease = NewLease(duration)
+	}
+	lease.Deadline = time.Now().Add(duration)
+	return writeLease(lock, lease)
+}
+
+// OwnsLock is true if this process holds the lock on the
+// task and the lock file has not been taken away from it.
+func (ti TaskInstance) OwnsLock() bool {
+	lock := ti.heldLock()
+	if lock == nil || lock.File() == nil {
+		return false
+	}
+	return sameFile(lock.fs, lock.File(), ti.LockFile().String())
+}
+
+// KeepAlive renews the lease of a locked task every third of
+// duration until the returned stop function is called.
+func (ti TaskInstance) KeepAlive(duration time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(duration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if errors.Is(ti.RenewLease(duration), ErrLeaseLost) {
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// IsOrphaned is true for a running task whose owner has gone
+// away: either nobody holds its lock anymore, or the lease on
+// it has expired without being renewed.
+func (ti TaskInstance) IsOrphaned() bool {
+	if ti.State() != StateRunning {
+		return false
+	}
+	if !ti.IsLocked() {
+		return true
+	}
+	lease, err := ti.GetLease()
+	return err == nil && lease.Expired()
+}
+
+// Reclaim takes an orphaned task away from its owner and
+// moves it back into pending so it can be claimed again.
+func (ti TaskInstance) Reclaim() (TaskInstance, error) {
+	// the owner's lock goes with the file, so its
+	// holder can no longer renew or finish the task.
+	err := ti.LockFile().Remove()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ti, err
+	}
+	ti.lock = nil
+	return ti.MoveTo(StatePending)
+}
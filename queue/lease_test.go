@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTaskInstance_Lease(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	running, err := ti.Claim()
+	assert.Nil(t, err)
+
+	lease, err := running.GetLease()
+	assert.Nil(t, err)
+	assert.Equal(t, os.Getpid(), lease.PID)
+	assert.False(t, lease.Expired())
+	assert.True(t, running.OwnsLock())
+	assert.False(t, running.IsOrphaned())
+
+	err = running.RenewLease(time.Hour)
+	assert.Nil(t, err)
+	renewed, err := running.GetLease()
+	assert.Nil(t, err)
+	assert.True(t, renewed.Deadline.After(lease.Deadline))
+	assert.Equal(t, lease.Acquired.Unix(), renewed.Acquired.Unix())
+
+	// a lease that is not renewed in time orphans the task.
+	err = running.RenewLease(-time.Second)
+	assert.Nil(t, err)
+	assert.True(t, running.IsOrphaned())
+
+	pending, err := running.Reclaim()
+	assert.Nil(t, err)
+	assert.Equal(t, StatePending, pending.State())
+	assert.False(t, pending.IsLocked())
+	assert.False(t, pending.LockFile().Exists())
+	assert.True(t, pending.IsReady())
+}
+
+func TestTaskInstance_LeaseLost(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	running, err := ti.Claim()
+	assert.Nil(t, err)
+
+	// the reaper takes the task from under its owner and it
+	// gets claimed again.
+	pending, err := running.Reclaim()
+	assert.Nil(t, err)
+	reclaimed, err := pending.Claim()
+	assert.Nil(t, err)
+
+	assert.False(t, running.OwnsLock())
+	assert.ErrorIs(t, running.RenewLease(time.Minute), ErrLeaseLost)
+	assert.True(t, reclaimed.OwnsLock())
+
+	// the previous owner letting go leaves the new claim intact.
+	err = running.ReleaseLock()
+	assert.Nil(t, err)
+	assert.True(t, reclaimed.LockFile().Exists())
+	assert.True(t, reclaimed.IsLocked())
+
+	err = reclaimed.ReleaseLock()
+	assert.Nil(t, err)
+}
+
+func TestTaskInstance_OrphanedWithoutLock(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	// a worker that died mid execution leaves its lock file
+	// behind, but nobody holds the lock on it.
+	running, err := ti.MoveTo(StateRunning)
+	assert.Nil(t, err)
+	err = running.LockFile().Write([]byte(`{}`))
+	assert.Nil(t, err)
+
+	assert.False(t, running.IsLocked())
+	assert.True(t, running.IsOrphaned())
+
+	orphans, err := tq.GetOrphanedTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(orphans))
+}
@@ -1,19 +1,26 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/spf13/afero"
 	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
 )
 
 // MasterQ has two tasks: first, it's a repository of registered task
 // instances; second, it's the primary interface to the file system
 // saving and retrieving of task execution instances.
 type MasterQ struct {
-	root       Path
-	fs         afero.Fs
-	tasks      map[string]TaskQueue
-	permission os.FileMode
+	root        Path
+	fs          afero.Fs
+	tasks       map[string]TaskQueue
+	permission  os.FileMode
+	concurrency int
 }
 
 var globalQ map[string]*MasterQ
@@ -44,10 +51,11 @@ func New(root string, fs afero.Fs, perm os.FileMode) (*MasterQ, error) {
 	}
 
 	newMasterQ := &MasterQ{
-		fs:         fs,
-		root:       rootDir,
-		tasks:      make(map[string]TaskQueue, 0),
-		permission: perm,
+		fs:          fs,
+		root:        rootDir,
+		tasks:       make(map[string]TaskQueue, 0),
+		permission:  perm,
+		concurrency: runtime.NumCPU(),
 	}
 
 	globalQ[rootDir.String()] = newMasterQ
@@ -78,15 +86,27 @@ func (q *MasterQ) Enqueue(name string) TaskQueue {
 }
 
 // Register the given instance of the task interface. The task is registered
-// by the derrived name.
-func (q *MasterQ) Register(task TaskExecutor, name string) error {
+// by the derrived name, and executed according to the given options.
+func (q *MasterQ) Register(task TaskExecutor, name string, opts ...QueueOption) error {
+	return q.RegisterContext(ContextExecutor(task), name, opts...)
+}
+
+// RegisterResult registers a task executor that produces
+// results, in the same way as Register.
+func (q *MasterQ) RegisterResult(task ResultTaskExecutor, name string, opts ...QueueOption) error {
+	return q.RegisterContext(ResultExecutor(task), name, opts...)
+}
+
+// RegisterContext registers a task executor that takes a
+// context, in the same way as Register.
+func (q *MasterQ) RegisterContext(task ContextTaskExecutor, name string, opts ...QueueOption) error {
 	//name := GetTaskName(task)
 	_, ok := q.tasks[name]
 	if ok {
 		return fmt.Errorf("tasks '%s' is already registered", name)
 	}
 	fmt.Printf("TASK REGISTERING: %s\n", name)
-	newTaskQ, err := NewTaskQueue(q.root, name, task)
+	newTaskQ, err := NewContextTaskQueue(q.root, name, task, opts...)
 	if err != nil {
 		return err
 	}
@@ -94,23 +114,184 @@ func (q *MasterQ) Register(task TaskExecutor, name string) error {
 	return nil
 }
 
-func (q *MasterQ) RunAllTasks() []error {
-	var errors []error
-	c := make(chan ExecuteTaskErr, 5)
-	for name, queue := range q.tasks {
-		fmt.Println(name)
-		tasks, err := queue.GetTaskInstances()
+// SetConcurrency sets the maximum number of task instances
+// RunAllTasks executes at the same time. It defaults to the
+// number of CPUs.
+func (q *MasterQ) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	q.concurrency = n
+}
+
+// Names returns the names of the registered task queues in order.
+func (q *MasterQ) Names() []string {
+	names := make([]string, 0, len(q.tasks))
+	for name := range q.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunAllTasks executes the ready task instances of every registered
+// queue on a pool of workers, and waits for all of them to finish.
+func (q *MasterQ) RunAllTasks() RunReport {
+	return q.RunAllTasksContext(context.Background())
+}
+
+// RunAllTasksContext is RunAllTasks with a context that is passed on
+// to the task executors. Once ctx is done no more task instances are
+// started. Expired task instances are moved out of the way first, and
+// results past their retention and stale key records are purged.
+func (q *MasterQ) RunAllTasksContext(ctx context.Context) RunReport {
+	report := RunReport{}
+	expired, err := q.ExpireTasks()
+	if err != nil {
+		report.Results = append(report.Results, TaskResult{Outcome: OutcomeError, Error: err})
+	}
+	for _, task := range expired {
+		report.Results = append(report.Results, TaskResult{Queue: task.name, Id: task.id, Outcome: OutcomeExpired})
+	}
+	_, err = q.PurgeResults()
+	if err != nil {
+		report.Results = append(report.Results, TaskResult{Outcome: OutcomeError, Error: err})
+	}
+	_, err = q.PurgeKeys()
+	if err != nil {
+		report.Results = append(report.Results, TaskResult{Outcome: OutcomeError, Error: err})
+	}
+
+	type job struct {
+		queue    TaskQueue
+		instance TaskInstance
+	}
+	jobs := make(chan job)
+	results := make(chan TaskResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- j.queue.ExecuteTaskContext(ctx, j.instance)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, name := range q.Names() {
+			queue := q.tasks[name]
+			tasks, err := queue.ReadyTaskInstances()
+			if err != nil {
+				results <- TaskResult{Queue: name, Outcome: OutcomeError, Error: err}
+				continue
+			}
+			for _, task := range tasks {
+				select {
+				case <-ctx.Done():
+					return
+				case jobs <- job{queue: queue, instance: task}:
+				}
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// NextDue returns the earliest time still to come at which a
+// pending task instance of any queue becomes due.
+func (q *MasterQ) NextDue() (time.Time, bool) {
+	next := time.Time{}
+	for _, name := range q.Names() {
+		dueAt, ok := q.tasks[name].NextDue()
+		if ok && (next.IsZero() || dueAt.Before(next)) {
+			next = dueAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// ReapOrphanedTasks moves every orphaned task instance, in all
+// registered queues, back into pending and returns the reclaimed
+// instances. Instances reclaimed by another process first are
+// skipped.
+func (q *MasterQ) ReapOrphanedTasks() ([]TaskInstance, error) {
+	var reclaimed []TaskInstance
+	var errs []error
+	for _, queue := range q.tasks {
+		orphans, err := queue.GetOrphanedTaskInstances()
 		if err != nil {
-			errors = append(errors, err)
+			errs = append(errs, err)
 			continue
 		}
-		for _, task := range tasks {
-			if !task.IsReady() {
+		for _, orphan := range orphans {
+			taskInst, err := orphan.Reclaim()
+			if errors.Is(err, os.ErrNotExist) {
 				continue
 			}
-			go ExecuteTask(queue.task, task, c)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			reclaimed = append(reclaimed, taskInst)
+		}
+	}
+	return reclaimed, errors.Join(errs...)
+}
+
+// ExpireTasks moves every expired pending task instance, in all
+// registered queues, into expired and returns the moved instances.
+func (q *MasterQ) ExpireTasks() ([]TaskInstance, error) {
+	var expired []TaskInstance
+	var errs []error
+	for _, name := range q.Names() {
+		instances, err := q.tasks[name].ExpireTaskInstances()
+		expired = append(expired, instances...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return expired, errors.Join(errs...)
+}
+
+// PurgeResults purges the succeeded task instances of every
+// registered queue that are past their result retention.
+func (q *MasterQ) PurgeResults() (int, error) {
+	purged := 0
+	var errs []error
+	for _, name := range q.Names() {
+		n, err := q.tasks[name].PurgeResults()
+		purged += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return purged, errors.Join(errs...)
+}
+
+// PurgeKeys purges the idempotency key records of every registered
+// queue that no longer hold back a task instance.
+func (q *MasterQ) PurgeKeys() (int, error) {
+	purged := 0
+	var errs []error
+	for _, name := range q.Names() {
+		n, err := q.tasks[name].PurgeKeys()
+		purged += n
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
-	close(c)
-	return UnwrapChannel(c)
+	return purged, errors.Join(errs...)
 }
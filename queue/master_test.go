@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 type MasterQSuite struct {
@@ -71,6 +72,112 @@ func (suite *MasterQSuite) TestMasterQ_Enqueue() {
 	assert.PanicsWithError(suite.T(), "task 'stone' is not registered", InvalidEnqueue)
 }
 
+func (suite *MasterQSuite) TestMasterQ_ReapOrphanedTasks() {
+	tq := suite.master.Enqueue("concrete")
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(suite.T(), err)
+
+	// simulate a worker that died while running the task.
+	running, err := ti.MoveTo(StateRunning)
+	assert.Nil(suite.T(), err)
+	err = running.LockFile().Write([]byte(`{}`))
+	assert.Nil(suite.T(), err)
+
+	reclaimed, err := suite.master.ReapOrphanedTasks()
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(reclaimed))
+	assert.Equal(suite.T(), ti.root, reclaimed[0].root)
+	assert.True(suite.T(), ti.IsReady())
+
+	err = ti.Remove()
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *MasterQSuite) TestMasterQ_RunAllTasks() {
+	tq := suite.master.Enqueue("concrete")
+	suite.master.SetConcurrency(2)
+
+	for i := 1; i <= 5; i++ {
+		_, err := tq.Send(TaskOptions{Id: i, Name: "Hello!"})
+		assert.Nil(suite.T(), err)
+	}
+
+	report := suite.master.RunAllTasks()
+	assert.Equal(suite.T(), 5, len(report.Results))
+	assert.Equal(suite.T(), 5, report.Count(OutcomeSucceeded))
+	assert.Nil(suite.T(), report.Errors())
+
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(pending))
+
+	// nothing is left to run.
+	report = suite.master.RunAllTasks()
+	assert.Equal(suite.T(), 0, len(report.Results))
+}
+
 func TestMasterQSuite(t *testing.T) {
 	suite.Run(t, new(MasterQSuite))
 }
+
+func TestMasterQ_ExpireTasks(t *testing.T) {
+	master, err := New("/expire/tasks", afero.NewMemMapFs(), 0777)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		delete(globalQ, master.root.String())
+	})
+	assert.Nil(t, master.Register(&ConcreteTask{}, "concrete"))
+	tq := master.Enqueue("concrete")
+
+	// expired while still waiting to become due.
+	_, err = tq.SendAfter(TaskOptions{Id: 1, Name: "Hello!"}, time.Hour, SendWithTTL(-time.Second))
+	assert.Nil(t, err)
+	_, err = tq.Send(TaskOptions{Id: 2, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	report := master.RunAllTasks()
+	assert.Equal(t, 1, report.Count(OutcomeExpired))
+	assert.Equal(t, 1, report.Count(OutcomeSucceeded))
+
+	expired, err := tq.GetTaskInstancesIn(StateExpired)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(expired))
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pending))
+
+	instances, err := master.ExpireTasks()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(instances))
+}
+
+func TestMasterQ_RunAllTasksPurges(t *testing.T) {
+	master, err := New("/run/purges", afero.NewMemMapFs(), 0777)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		delete(globalQ, master.root.String())
+	})
+	assert.Nil(t, master.Register(&ConcreteTask{}, "concrete", WithResultRetention(time.Nanosecond)))
+	tq := master.Enqueue("concrete")
+
+	_, err = tq.Send(TaskOptions{Id: 1, Name: "Hello!"}, SendWithKey("hello"))
+	assert.Nil(t, err)
+	report := master.RunAllTasks()
+	assert.Equal(t, 1, report.Count(OutcomeSucceeded))
+	done, err := tq.GetTaskInstancesIn(StateDone)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(done))
+
+	// the next run purges the instance past its
+	// retention, and the record of its key.
+	time.Sleep(time.Millisecond)
+	report = master.RunAllTasks()
+	assert.Equal(t, 0, len(report.Results))
+	done, err = tq.GetTaskInstancesIn(StateDone)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(done))
+	keys, err := tq.root.Join(keysDir).ReadDir()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+}
@@ -0,0 +1,258 @@
+package queue
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// QueueOptions configure how the task instances of
+// a TaskQueue are executed.
+type QueueOptions struct {
+	// MaxConcurrency caps how many instances of the queue are
+	// executed at the same time, across every process sharing
+	// the same root. Zero means no limit.
+	MaxConcurrency int
+	// Timeout is the maximum time a task instance may execute
+	// before it is cancelled and recorded as timed out. Zero means
+	// no limit. It can be overridden per instance when sent.
+	Timeout time.Duration
+	// Retry decides whether, and when, a failed task instance
+	// is attempted again. The zero value never retries.
+	Retry RetryPolicy
+	// FIFO executes the queue's task instances one at a time, in
+	// the order they were sent, whatever their priority. An instance
+	// waiting on a retry holds up the ones sent after it.
+	FIFO bool
+	// DedupeWindow is how long after a task instance sent with an
+	// idempotency key has finished that duplicates of it are still
+	// refused. Zero only refuses them while it is pending or running.
+	DedupeWindow time.Duration
+	// TTL is how long after being sent a task instance expires,
+	// unless it was sent with an expiry of its own. Zero means
+	// task instances do not expire.
+	TTL time.Duration
+	// ResultRetention is how long succeeded task instances, and
+	// their results, are kept in done. Zero defaults to
+	// DefaultResultRetention, and a negative retention keeps
+	// them forever. They are purged by MasterQ.RunAllTasks and
+	// the Worker, or else by calling PurgeResults.
+	ResultRetention time.Duration
+}
+
+// DefaultResultRetention is how long succeeded task instances
+// are kept unless the queue says otherwise.
+const DefaultResultRetention = 24 * time.Hour
+
+// DefaultFollowUpRetry is how often, and how soon, the follow ups of
+// a succeeded task instance are sent again when its queue does not
+// retry failed task instances.
+var DefaultFollowUpRetry = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+}
+
+// RetryPolicy describes how often, and how soon, a failed task
+// instance is retried. The delay before each retry grows by Factor
+// from BaseDelay, is randomized by plus or minus Jitter of itself,
+// and is capped at MaxDelay.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times an instance is
+	// executed, including the first. Below 2 nothing is retried.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// Factor multiplies the delay after each failed attempt.
+	// Zero defaults to 2.
+	Factor float64
+	// Jitter is the fraction, between 0 and 1, of the delay
+	// that is randomized.
+	Jitter   float64
+	MaxDelay time.Duration
+}
+
+// ShouldRetry is true if an instance that has failed
+// attempts times is to be executed again.
+func (p RetryPolicy) ShouldRetry(attempts int) bool {
+	return attempts < p.MaxAttempts
+}
+
+// Delay returns how long to wait before the next attempt of
+// an instance that has failed attempts times.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	factor := p.Factor
+	if factor == 0 {
+		factor = 2
+	}
+	delay := float64(p.BaseDelay) * math.Pow(factor, float64(attempts-1))
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// QueueOption sets a field of QueueOptions when a
+// task queue is registered.
+type QueueOption func(*QueueOptions)
+
+func NewQueueOptions(opts ...QueueOption) QueueOptions {
+	options := QueueOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.FIFO {
+		options.MaxConcurrency = 1
+	}
+	if options.ResultRetention == 0 {
+		options.ResultRetention = DefaultResultRetention
+	}
+	return options
+}
+
+// WithMaxConcurrency limits the queue to n concurrent executions.
+func WithMaxConcurrency(n int) QueueOption {
+	return func(o *QueueOptions) {
+		o.MaxConcurrency = n
+	}
+}
+
+// WithTimeout limits the execution time of each of the queue's
+// task instances.
+func WithTimeout(timeout time.Duration) QueueOption {
+	return func(o *QueueOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// WithRetry retries the queue's failed task instances
+// according to policy.
+func WithRetry(policy RetryPolicy) QueueOption {
+	return func(o *QueueOptions) {
+		o.Retry = policy
+	}
+}
+
+// WithFIFO executes the queue's task instances strictly in
+// the order they were sent, one at a time. Their priorities
+// are ignored.
+func WithFIFO() QueueOption {
+	return func(o *QueueOptions) {
+		o.FIFO = true
+	}
+}
+
+// WithDedupeWindow refuses duplicates of a task instance sent
+// with an idempotency key for window after it has finished.
+func WithDedupeWindow(window time.Duration) QueueOption {
+	return func(o *QueueOptions) {
+		o.DedupeWindow = window
+	}
+}
+
+// WithTTL expires the queue's task instances that have
+// not been executed within ttl of being sent.
+func WithTTL(ttl time.Duration) QueueOption {
+	return func(o *QueueOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithResultRetention purges succeeded task instances, along
+// with their results, once retention has passed. A negative
+// retention keeps them forever.
+func WithResultRetention(retention time.Duration) QueueOption {
+	return func(o *QueueOptions) {
+		o.ResultRetention = retention
+	}
+}
+
+// SendOption sets a field of the TaskMeta persisted alongside
+// a task instance when it is sent.
+type SendOption func(*TaskMeta)
+
+func NewTaskMeta(opts ...SendOption) TaskMeta {
+	meta := TaskMeta{}
+	for _, opt := range opts {
+		opt(&meta)
+	}
+	return meta
+}
+
+// SendWithTimeout overrides the queue's execution timeout
+// for a single task instance.
+func SendWithTimeout(timeout time.Duration) SendOption {
+	return func(m *TaskMeta) {
+		m.Timeout = timeout
+	}
+}
+
+// SendWithRunAt holds the task instance back until at.
+func SendWithRunAt(at time.Time) SendOption {
+	return func(m *TaskMeta) {
+		m.RunAt = at
+	}
+}
+
+// SendWithDelay holds the task instance back until
+// delay has passed from the time it is sent.
+func SendWithDelay(delay time.Duration) SendOption {
+	return func(m *TaskMeta) {
+		m.RunAt = time.Now().Add(delay)
+	}
+}
+
+// SendWithPriority executes the task instance ahead of those in
+// its queue with a lower priority, unless the queue is FIFO. The
+// default priority is 0.
+func SendWithPriority(priority int) SendOption {
+	return func(m *TaskMeta) {
+		m.Priority = priority
+	}
+}
+
+// SendWithKey gives the task instance an idempotency key. While an
+// instance with the same key is pending or running, or finished within
+// the queue's dedupe window, Send refuses to send another one.
+func SendWithKey(key string) SendOption {
+	return func(m *TaskMeta) {
+		m.Key = key
+	}
+}
+
+// SendUnique is SendWithKey with a key derived from a hash
+// of the task arguments.
+func SendUnique() SendOption {
+	return func(m *TaskMeta) {
+		m.unique = true
+	}
+}
+
+// SendWithExpiry expires the task instance if it has not been
+// executed by at, instead of executing it late.
+func SendWithExpiry(at time.Time) SendOption {
+	return func(m *TaskMeta) {
+		m.ExpiresAt = at
+	}
+}
+
+// SendWithTTL expires the task instance if it has not been
+// executed within ttl of being sent.
+func SendWithTTL(ttl time.Duration) SendOption {
+	return func(m *TaskMeta) {
+		m.ExpiresAt = time.Now().Add(ttl)
+	}
+}
+
+// SendWithFollowUps sends the follow up task instances once the task
+// instance has succeeded.
+func SendWithFollowUps(followUps ...FollowUp) SendOption {
+	return func(m *TaskMeta) {
+		m.FollowUps = append(m.FollowUps, followUps...)
+	}
+}
@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewQueueOptions(t *testing.T) {
+	options := NewQueueOptions(
+		WithMaxConcurrency(3),
+		WithTimeout(time.Minute),
+	)
+	assert.Equal(t, 3, options.MaxConcurrency)
+	assert.Equal(t, time.Minute, options.Timeout)
+	assert.False(t, options.Retry.ShouldRetry(1))
+	assert.Equal(t, DefaultResultRetention, options.ResultRetention)
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    5 * time.Second,
+	}
+	assert.True(t, policy.ShouldRetry(4))
+	assert.False(t, policy.ShouldRetry(5))
+
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, 2*time.Second, policy.Delay(2))
+	assert.Equal(t, 4*time.Second, policy.Delay(3))
+	assert.Equal(t, 5*time.Second, policy.Delay(4))
+
+	policy.Factor = 3
+	assert.Equal(t, 3*time.Second, policy.Delay(2))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(2)
+		assert.True(t, delay >= 1500*time.Millisecond && delay <= 4500*time.Millisecond, delay)
+	}
+}
@@ -1,13 +1,19 @@
 package queue
 
 import (
+	"fmt"
 	"github.com/spf13/afero"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+// renameMu serializes renames on file systems that are not backed
+// by the OS, where Fs.Rename is neither atomic nor exclusive.
+var renameMu sync.Mutex
+
 type Path struct {
 	path     string
 	fs       afero.Fs
@@ -126,6 +132,66 @@ func (pth Path) Remove() error {
 	return pth.fs.Remove(pth.path)
 }
 
+func (pth Path) RemoveAll() error {
+	return pth.fs.RemoveAll(pth.path)
+}
+
+// Rename moves the file or directory to dst. The rename fails if
+// dst already exists, or if the source has already been moved,
+// so only one of any number of concurrent renames can succeed.
+func (pth Path) Rename(dst Path) error {
+	if isOsFs(pth.fs) {
+		if dst.Exists() {
+			return &os.LinkError{Op: "rename", Old: pth.path, New: dst.path, Err: os.ErrExist}
+		}
+		return pth.fs.Rename(pth.path, dst.path)
+	}
+	renameMu.Lock()
+	defer renameMu.Unlock()
+	if !pth.Exists() {
+		return &os.LinkError{Op: "rename", Old: pth.path, New: dst.path, Err: os.ErrNotExist}
+	}
+	if dst.Exists() {
+		return &os.LinkError{Op: "rename", Old: pth.path, New: dst.path, Err: os.ErrExist}
+	}
+	return moveAll(pth.fs, pth.path, dst.path)
+}
+
+// moveAll renames src to dst one file at a time, as afero.MemMapFs
+// does not carry the contents of a directory along when renaming it.
+func moveAll(fs afero.Fs, src string, dst string) error {
+	info, err := fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fs.Rename(src, dst)
+	}
+	err = fs.MkdirAll(dst, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	content, err := afero.ReadDir(fs, src)
+	if err != nil {
+		return err
+	}
+	for _, child := range content {
+		err = moveAll(fs, filepath.Join(src, child.Name()), filepath.Join(dst, child.Name()))
+		if err != nil {
+			return fmt.Errorf("moving %s: %w", src, err)
+		}
+	}
+	return fs.Remove(src)
+}
+
+func isOsFs(fs afero.Fs) bool {
+	switch fs.(type) {
+	case *afero.OsFs, afero.OsFs:
+		return true
+	}
+	return false
+}
+
 func (pth Path) Stat() (os.FileInfo, error) {
 	return pth.fs.Stat(pth.path)
 }
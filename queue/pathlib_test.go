@@ -3,6 +3,7 @@ package queue
 import (
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
 )
 
@@ -79,3 +80,34 @@ func TestPath_Write(t *testing.T) {
 	assert.Equal(t, true, pth.IsFile())
 
 }
+
+func TestPath_Rename(t *testing.T) {
+	pth := MakePath()
+	src := pth.Join("a")
+	dst := pth.Join("b")
+
+	err := src.Join("child").MkDirs()
+	assert.Nil(t, err)
+	err = src.Join("child", "file.txt").Write([]byte("data"))
+	assert.Nil(t, err)
+
+	err = src.Rename(dst)
+	assert.Nil(t, err)
+
+	assert.False(t, src.Exists())
+	assert.False(t, src.Join("child", "file.txt").Exists())
+
+	data, err := dst.Join("child", "file.txt").Read()
+	assert.Nil(t, err)
+	assert.Equal(t, "data", string(data))
+
+	// the source is gone, so a second rename fails.
+	err = src.Rename(pth.Join("c"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// and renaming onto an existing path is refused.
+	err = pth.Join("c").MkDirs()
+	assert.Nil(t, err)
+	err = dst.Rename(pth.Join("c"))
+	assert.ErrorIs(t, err, os.ErrExist)
+}
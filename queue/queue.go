@@ -1,54 +1,252 @@
 package queue
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	gonanoid "github.com/matoous/go-nanoid/v2"
+	"os"
+	"sort"
+	"time"
 )
 
 type TaskHandler func(instance TaskInstance)
 
+// NewTaskId returns a new time sortable task id.
 func NewTaskId() string {
-	return gonanoid.Must(15)
+	return newTaskId(time.Now())
+}
+
+// ErrQueueBusy is returned when a task queue is already
+// executing its maximum number of task instances.
+var ErrQueueBusy = errors.New("task queue is busy")
+
+// ErrTaskSkipped is returned by Run when the task instance it sent
+// was not executed: it was not at the head of its FIFO queue, or
+// was claimed by somebody else first.
+var ErrTaskSkipped = errors.New("task was skipped")
+
+// slotPollInterval is how often a blocked runner checks
+// for a free execution slot.
+const slotPollInterval = 50 * time.Millisecond
+
+const slotsDir = "slots"
+
+// isReservedDir is true for the queue sub directories
+// that do not hold task instances.
+func isReservedDir(name string) bool {
+	return isTaskState(name) || name == slotsDir || name == keysDir || name == stagingDir
 }
 
 type TaskQueue struct {
 	root Path
 	name string
-	task TaskExecutor
+	task ContextTaskExecutor
+	opts QueueOptions
 }
 
+// Initialize creates the queue directory along with its state
+// directories, and migrates any task instances left in the
+// flat layout of earlier versions.
 func (tq TaskQueue) Initialize() error {
-	return tq.root.MkDirs()
+	for _, state := range taskStates {
+		err := tq.StateDir(state).MkDirs()
+		if err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{slotsDir, keysDir, stagingDir} {
+		err := tq.root.Join(dir).MkDirs()
+		if err != nil {
+			return err
+		}
+	}
+	return tq.Migrate()
+}
+
+// Options returns the options the queue was registered with.
+func (tq TaskQueue) Options() QueueOptions {
+	return tq.opts
+}
+
+// AcquireSlot takes one of the queue's MaxConcurrency execution
+// slots, each of which is a lock file shared by every process using
+// the same root. If all slots are taken ErrQueueBusy is returned,
+// or when block is true AcquireSlot waits for one to be freed. A
+// queue without a limit returns a nil slot.
+func (tq TaskQueue) AcquireSlot(block bool) (*FileLock, error) {
+	return tq.AcquireSlotContext(context.Background(), block)
+}
+
+// AcquireSlotContext is AcquireSlot with a context that stops
+// the wait for a free slot once it is done.
+func (tq TaskQueue) AcquireSlotContext(ctx context.Context, block bool) (*FileLock, error) {
+	if tq.opts.MaxConcurrency <= 0 {
+		return nil, nil
+	}
+	for {
+		for i := 0; i < tq.opts.MaxConcurrency; i++ {
+			slotFile := tq.root.Join(slotsDir, fmt.Sprintf("%d.lock", i))
+			slot := NewFileLock(slotFile.fs, slotFile.String())
+			err := slot.TryAcquire()
+			if err == nil {
+				return slot, nil
+			}
+			if !errors.Is(err, ErrLocked) {
+				return nil, err
+			}
+		}
+		if !block {
+			return nil, fmt.Errorf("%w: %s", ErrQueueBusy, tq.name)
+		}
+		timer := time.NewTimer(slotPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Migrate moves task instances stored directly in the queue
+// directory, as they were before state directories, into pending,
+// or into failed if they have an error file. Instances that are
+// currently locked are left for a later migration.
+func (tq TaskQueue) Migrate() error {
+	dirs, err := tq.root.ReadDir()
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || isReservedDir(dir.Name()) {
+			continue
+		}
+		taskInst := TaskInstance{
+			id:   dir.Name(),
+			name: tq.name,
+			root: dir,
+		}
+		if taskInst.IsLocked() {
+			continue
+		}
+		// earlier versions never locked the .lock file, so
+		// any that remain are stale.
+		err = taskInst.ReleaseLock()
+		if err != nil {
+			return err
+		}
+		state := StatePending
+		if taskInst.HasError() {
+			state = StateFailed
+		}
+		_, err = taskInst.moveInto(tq.StateDir(state))
+		// another process may be migrating the same queue.
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
 }
 
+// StateDir returns the Path of the directory holding the
+// task instances in the given state.
+func (tq TaskQueue) StateDir(state TaskState) Path {
+	return tq.root.Join(string(state))
+}
+
+// Task returns the TaskExecutor the queue was registered with.
+//
 //nolint:ireturn
 func (tq TaskQueue) Task() TaskExecutor {
+	switch task := tq.task.(type) {
+	case contextAdapter:
+		return task.TaskExecutor
+	case TaskExecutor:
+		return task
+	default:
+		return executorAdapter{tq.task}
+	}
+}
+
+// Executor returns the ContextTaskExecutor the queue executes.
+//
+//nolint:ireturn
+func (tq TaskQueue) Executor() ContextTaskExecutor {
 	return tq.task
 }
 
 func (tq TaskQueue) CreateTaskInstance() TaskInstance {
-	id := NewTaskId()
+	return tq.createTaskInstance(0)
+}
+
+func (tq TaskQueue) createTaskInstance(priority int) TaskInstance {
+	return tq.newTaskInstance(NewTaskId(), priority)
+}
+
+// newTaskInstance returns the pending task instance id, which
+// is yet to be written to disk.
+func (tq TaskQueue) newTaskInstance(id string, priority int) TaskInstance {
 	ti := TaskInstance{
-		id:   id,
-		name: tq.name,
-		root: tq.root.Join(id),
+		id:       id,
+		name:     tq.name,
+		priority: priority,
+		root:     tq.StateDir(StatePending).Join(taskDirName(id, priority)),
 	}
 	return ti
 }
 
 func (tq TaskQueue) LoadTaskInstance(taskDir Path) TaskInstance {
+	id, priority := parseTaskDirName(taskDir.Name())
 	return TaskInstance{
-		id:   taskDir.Name(),
-		name: taskDir.Parent().Name(),
-		root: taskDir,
+		id:       id,
+		name:     tq.name,
+		priority: priority,
+		root:     taskDir,
+	}
+}
+
+// FindTaskInstance returns the task instance id in the given state.
+func (tq TaskQueue) FindTaskInstance(state TaskState, id string) (TaskInstance, error) {
+	dir := tq.StateDir(state)
+	taskDir, ok := findTaskDir(dir, id)
+	if !ok {
+		return TaskInstance{}, &os.PathError{Op: "find", Path: dir.Join(id).String(), Err: os.ErrNotExist}
+	}
+	return tq.LoadTaskInstance(taskDir), nil
+}
+
+// findTaskDir returns the directory of task id in stateDir,
+// whatever priority suffix it has.
+func findTaskDir(stateDir Path, id string) (Path, bool) {
+	if stateDir.Join(id).Exists() {
+		return stateDir.Join(id), true
+	}
+	dirs, err := stateDir.ReadDir()
+	if err != nil {
+		return Path{}, false
 	}
+	for _, dir := range dirs {
+		dirId, _ := parseTaskDirName(dir.Name())
+		if dirId == id && dir.IsDir() {
+			return dir, true
+		}
+	}
+	return Path{}, false
 }
 
+// GetTaskInstances returns the pending task instances.
 func (tq TaskQueue) GetTaskInstances() ([]TaskInstance, error) {
+	return tq.GetTaskInstancesIn(StatePending)
+}
+
+// GetTaskInstancesIn returns the task instances in the given
+// state, those with the highest priority first and otherwise
+// in the order they were sent.
+func (tq TaskQueue) GetTaskInstancesIn(state TaskState) ([]TaskInstance, error) {
 	tasks := []TaskInstance{}
 
-	dirs, err := tq.root.ReadDir()
+	dirs, err := tq.StateDir(state).ReadDir()
 	if err != nil {
 		return tasks, err
 	}
@@ -56,32 +254,129 @@ func (tq TaskQueue) GetTaskInstances() ([]TaskInstance, error) {
 		if !dir.IsDir() {
 			continue
 		}
-		fmt.Println(dir.Name())
 		taskInst := tq.LoadTaskInstance(dir)
 		tasks = append(tasks, taskInst)
 	}
+	sortTaskInstances(tasks, true)
 	return tasks, nil
 }
 
-func (tq TaskQueue) IterTaskInstances(handler TaskHandler) error {
-	dirs, err := tq.root.ReadDir()
+// sortTaskInstances sorts the task instances in the order they were
+// sent, those with the highest priority first if byPriority is true.
+func sortTaskInstances(tasks []TaskInstance, byPriority bool) {
+	sentAt := make(map[string]time.Time, len(tasks))
+	for _, task := range tasks {
+		sentAt[task.id] = task.SentAt()
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if byPriority && a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		if !sentAt[a.id].Equal(sentAt[b.id]) {
+			return sentAt[a.id].Before(sentAt[b.id])
+		}
+		return a.id < b.id
+	})
+}
+
+// ReadyTaskInstances returns the pending task instances that are
+// ready to be executed, in the order they should be. For a FIFO
+// queue that is at most the instance at the head of the queue.
+func (tq TaskQueue) ReadyTaskInstances() ([]TaskInstance, error) {
+	ready := []TaskInstance{}
+	if tq.opts.FIFO {
+		head, ok, err := tq.head()
+		if err == nil && ok && head.IsReady() {
+			ready = append(ready, head)
+		}
+		return ready, err
+	}
+	tasks, err := tq.GetTaskInstances()
 	if err != nil {
-		return err
+		return ready, err
 	}
-	for _, dir := range dirs {
-		if !dir.IsDir() {
+	for _, task := range tasks {
+		if task.IsReady() {
+			ready = append(ready, task)
+		}
+	}
+	return ready, nil
+}
+
+// GetOrphanedTaskInstances returns the running task instances
+// whose owner has died or stopped renewing its lease.
+func (tq TaskQueue) GetOrphanedTaskInstances() ([]TaskInstance, error) {
+	orphans := []TaskInstance{}
+	tasks, err := tq.GetTaskInstancesIn(StateRunning)
+	if err != nil {
+		return orphans, err
+	}
+	for _, taskInst := range tasks {
+		if taskInst.IsOrphaned() {
+			orphans = append(orphans, taskInst)
+		}
+	}
+	return orphans, nil
+}
+
+// NextDue returns the earliest time still to come at which
+// a pending task instance becomes due. It is false if no
+// instance is waiting on a run at or retry time.
+func (tq TaskQueue) NextDue() (time.Time, bool) {
+	next := time.Time{}
+	tasks, err := tq.GetTaskInstances()
+	if err != nil {
+		return next, false
+	}
+	now := time.Now()
+	for _, task := range tasks {
+		dueAt, ok := task.DueAt()
+		if !ok || !dueAt.After(now) {
 			continue
 		}
-		fmt.Println(dir.Name())
-		taskInst := tq.LoadTaskInstance(dir)
+		if next.IsZero() || dueAt.Before(next) {
+			next = dueAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// head returns the first pending task instance of the queue, in the
+// order they were sent whatever their priority. Instances sent to run
+// at a later time only join the queue once it has come.
+func (tq TaskQueue) head() (TaskInstance, bool, error) {
+	tasks, err := tq.GetTaskInstances()
+	if err != nil {
+		return TaskInstance{}, false, err
+	}
+	sortTaskInstances(tasks, false)
+	now := time.Now()
+	for _, task := range tasks {
+		runAt, ok := task.RunAt()
+		if ok && now.Before(runAt) {
+			continue
+		}
+		return task, true, nil
+	}
+	return TaskInstance{}, false, nil
+}
+
+// IterTaskInstances calls handler with each pending task instance.
+func (tq TaskQueue) IterTaskInstances(handler TaskHandler) error {
+	tasks, err := tq.GetTaskInstances()
+	if err != nil {
+		return err
+	}
+	for _, taskInst := range tasks {
 		handler(taskInst)
 	}
 	return nil
 }
 
 // Send creates a new TaskInstance on disk with the given
-// task arguments.
-func (tq TaskQueue) Send(opt any) (TaskInstance, error) {
+// task arguments, and any per instance settings.
+func (tq TaskQueue) Send(opt any, opts ...SendOption) (TaskInstance, error) {
 
 	err := tq.task.Assert(opt)
 	if err != nil {
@@ -94,8 +389,32 @@ func (tq TaskQueue) Send(opt any) (TaskInstance, error) {
 		return TaskInstance{}, err
 	}
 
-	ti := tq.CreateTaskInstance()
-	err = ti.Initialize()
+	meta := NewTaskMeta(opts...)
+	err = tq.checkFollowUps(meta.FollowUps)
+	if err != nil {
+		return TaskInstance{}, err
+	}
+	if meta.ExpiresAt.IsZero() && tq.opts.TTL > 0 {
+		meta.ExpiresAt = time.Now().Add(tq.opts.TTL)
+	}
+	if meta.unique {
+		meta.Key = argsKey(serializedTaskArgs)
+		meta.unique = false
+	}
+	if meta.Key != "" {
+		return tq.sendUnique(serializedTaskArgs, meta)
+	}
+	return tq.send(serializedTaskArgs, meta)
+}
+
+// send writes a new task instance into pending.
+func (tq TaskQueue) send(serializedTaskArgs []byte, meta TaskMeta) (TaskInstance, error) {
+	return tq.write(tq.createTaskInstance(meta.Priority), serializedTaskArgs, meta)
+}
+
+// write writes the task instance ti into pending.
+func (tq TaskQueue) write(ti TaskInstance, serializedTaskArgs []byte, meta TaskMeta) (TaskInstance, error) {
+	err := ti.Initialize()
 	if err != nil {
 		return ti, err
 	}
@@ -105,6 +424,13 @@ func (tq TaskQueue) Send(opt any) (TaskInstance, error) {
 		return ti, err
 	}
 
+	if !meta.IsZero() {
+		err = ti.WriteMeta(meta)
+		if err != nil {
+			return ti, err
+		}
+	}
+
 	err = ti.ReleaseLock()
 	if err != nil {
 		return ti, err
@@ -113,32 +439,411 @@ func (tq TaskQueue) Send(opt any) (TaskInstance, error) {
 	return ti, nil
 }
 
+// SendAt sends a task instance that is not executed before at.
+func (tq TaskQueue) SendAt(opt any, at time.Time, opts ...SendOption) (TaskInstance, error) {
+	return tq.Send(opt, append(opts, SendWithRunAt(at))...)
+}
+
+// SendAfter sends a task instance that is not executed
+// before delay has passed.
+func (tq TaskQueue) SendAfter(opt any, delay time.Duration, opts ...SendOption) (TaskInstance, error) {
+	return tq.Send(opt, append(opts, SendWithDelay(delay))...)
+}
+
 // Run creates a new TaskInstance on disk with the given
-// task arguments, and then immediately executes.
-func (tq TaskQueue) Run(opt any) (TaskInstance, error) {
-	ti, err := tq.Send(opt)
+// task arguments, and then immediately executes. ErrTaskSkipped
+// is returned if it could not be executed.
+func (tq TaskQueue) Run(opt any, opts ...SendOption) (TaskInstance, error) {
+	return tq.RunContext(context.Background(), opt, opts...)
+}
+
+// RunContext is Run with a context that is passed on
+// to the task executor. A task instance sent to run at a
+// later time is waited for.
+func (tq TaskQueue) RunContext(ctx context.Context, opt any, opts ...SendOption) (TaskInstance, error) {
+	ti, err := tq.Send(opt, opts...)
+	if err != nil {
+		return ti, err
+	}
+
+	if runAt, ok := ti.RunAt(); ok {
+		timer := time.NewTimer(time.Until(runAt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ti, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	slot, err := tq.AcquireSlotContext(ctx, true)
 	if err != nil {
 		return ti, err
 	}
 
-	c := make(chan ExecuteTaskErr, 5)
-	ExecuteTask(tq.task, ti, c)
-	close(c)
+	result := tq.execute(ctx, ti, slot)
+	if result.Outcome == OutcomeSkipped && result.Error == nil {
+		return ti, fmt.Errorf("%w: %s", ErrTaskSkipped, ti.id)
+	}
+	return ti, result.Error
+}
 
-	errors := UnwrapChannel(c)
+// ExecuteTask claims the task instance and executes it, moving it
+// into done on success, or into failed with the error recorded in
+// its error file. A task already claimed by somebody else, one that
+// is not due yet, or one whose queue has no free execution slot,
+// is skipped.
+func (tq TaskQueue) ExecuteTask(instance TaskInstance) TaskResult {
+	return tq.ExecuteTaskContext(context.Background(), instance)
+}
+
+// ExecuteTaskContext is ExecuteTask with a context that is passed
+// on to the task executor. If ctx is cancelled while the task is
+// executing, and the executor gives up with an error, the task is
+// returned to pending to be run again later.
+func (tq TaskQueue) ExecuteTaskContext(ctx context.Context, instance TaskInstance) TaskResult {
+	if ctx.Err() != nil {
+		return TaskResult{Queue: tq.name, Id: instance.id, Outcome: OutcomeSkipped}
+	}
+	slot, err := tq.AcquireSlot(false)
+	if errors.Is(err, ErrQueueBusy) {
+		return TaskResult{Queue: tq.name, Id: instance.id, Outcome: OutcomeSkipped}
+	}
+	if err != nil {
+		return TaskResult{Queue: tq.name, Id: instance.id, Outcome: OutcomeError, Error: err}
+	}
+	return tq.execute(ctx, instance, slot)
+}
 
-	if errors != nil {
-		return ti, errors[0]
+// execute claims and executes the instance, then releases it along
+// with the execution slot taken for it, if any.
+func (tq TaskQueue) execute(ctx context.Context, instance TaskInstance, slot *FileLock) (result TaskResult) {
+	result = TaskResult{
+		Queue: tq.name,
+		Id:    instance.id,
 	}
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
 
-	return ti, nil
+	instance, result, ok := tq.claim(result, instance)
+	if !ok {
+		return release(result, nil, slot)
+	}
+	result, ok = tq.settle(result, &instance)
+	if ok {
+		return release(result, &instance, slot)
+	}
+
+	execErr := tq.run(ctx, instance)
+	result = tq.finish(ctx, result, &instance, execErr)
+	return release(result, &instance, slot)
+}
+
+// release releases the lock of the claimed instance, if any, and
+// the execution slot, reporting the first error if there was none.
+func release(result TaskResult, instance *TaskInstance, slot *FileLock) TaskResult {
+	var err error
+	if instance != nil {
+		err = instance.ReleaseLock()
+	}
+	if slot != nil {
+		err = errors.Join(err, slot.Release())
+	}
+	if err != nil && result.Error == nil {
+		result.Outcome = OutcomeError
+		result.Error = err
+	}
+	return result
+}
+
+// claim claims the instance to execute it. It is false, with the
+// outcome reported, if the instance is not to be executed now.
+func (tq TaskQueue) claim(result TaskResult, instance TaskInstance) (TaskInstance, TaskResult, bool) {
+	// an expired or cancelled instance is claimed to be moved
+	// out of the way, rather than waiting for its turn.
+	if !instance.IsExpired() && !instance.IsCancelRequested() && (!instance.isDue() || !tq.isHead(instance)) {
+		result.Outcome = OutcomeSkipped
+		return instance, result, false
+	}
+
+	claimed, err := instance.Claim()
+	if errors.Is(err, ErrTaskLocked) {
+		result.Outcome = OutcomeSkipped
+		return instance, result, false
+	}
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Error = err
+		return instance, result, false
+	}
+	return claimed, result, true
+}
+
+// settle finishes the claimed instance without executing it when
+// it expired, was cancelled, or succeeded before but its worker
+// went away before all of its follow ups were sent. It is false
+// for an instance that is to be executed.
+func (tq TaskQueue) settle(result TaskResult, instance *TaskInstance) (TaskResult, bool) {
+	switch {
+	case instance.IsExpired():
+		result.Outcome = OutcomeExpired
+		result.Error = tq.expire(instance)
+		if result.Error != nil {
+			result.Outcome = OutcomeError
+		}
+		return result, true
+	case instance.IsCancelRequested():
+		return tq.cancelled(result, instance, nil), true
+	case instance.followUpsRecorded():
+		return tq.succeeded(result, instance), true
+	}
+	return result, false
+}
+
+// run executes the claimed instance and stores its result. The
+// lease of the instance is kept alive meanwhile, and the executor
+// is cancelled once the instance is asked to be cancelled.
+func (tq TaskQueue) run(ctx context.Context, instance TaskInstance) error {
+	stopKeepAlive := instance.KeepAlive(DefaultLeaseDuration)
+	defer stopKeepAlive()
+	execCtx, cancelExec := context.WithCancel(ctx)
+	defer cancelExec()
+	stopWatch := instance.watchCancel(cancelExec)
+	defer stopWatch()
+
+	data, err := instance.TaskFile().Read()
+	if err != nil {
+		return err
+	}
+	value, err := tq.executeTimeout(execCtx, instance, data)
+	if err != nil || !tq.hasResults() {
+		return err
+	}
+	return instance.writeResult(value)
+}
+
+// finish moves the executed instance on by how its execution
+// ended, and reports it.
+func (tq TaskQueue) finish(ctx context.Context, result TaskResult, instance *TaskInstance, execErr error) TaskResult {
+	switch {
+	case !instance.OwnsLock():
+		// the task was reclaimed while we were executing it, so
+		// whatever happens to it next is no longer up to us.
+		result.Outcome = OutcomeError
+		result.Error = fmt.Errorf("%w: %s", ErrLeaseLost, instance.id)
+		return result
+	case execErr == nil:
+		return tq.succeeded(result, instance)
+	case instance.IsCancelRequested():
+		// a task that finished regardless of being
+		// cancelled has succeeded all the same.
+		return tq.cancelled(result, instance, execErr)
+	case ctx.Err() != nil:
+		return tq.interrupted(result, instance, execErr)
+	}
+	return tq.failed(result, instance, execErr)
+}
+
+// interrupted returns the instance, whose run was cancelled
+// while it was executing, to pending and reports it.
+func (tq TaskQueue) interrupted(result TaskResult, instance *TaskInstance, execErr error) TaskResult {
+	result.Outcome = OutcomeInterrupted
+	result.Error = execErr
+	var err error
+	*instance, err = instance.MoveTo(StatePending)
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Error = errors.Join(execErr, err)
+	}
+	return result
+}
+
+// failed records the execution error of the instance, moves
+// it on as the error and the retry policy decide, and reports it.
+func (tq TaskQueue) failed(result TaskResult, instance *TaskInstance, execErr error) TaskResult {
+	outcome, err := tq.fail(instance, execErr)
+	result.Outcome = outcome
+	result.Error = execErr
+	if err == nil && outcome != OutcomeRetrying {
+		err = tq.finishKey(*instance)
+	}
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Error = errors.Join(execErr, err)
+	}
+	return result
+}
+
+// succeeded sends the follow ups of the claimed instance,
+// moves it into done and reports it.
+func (tq TaskQueue) succeeded(result TaskResult, instance *TaskInstance) TaskResult {
+	err := tq.sendFollowUps(*instance)
+	if err != nil {
+		// follow ups that could not be sent are retried, and
+		// dead-lettered, like a failed execution, even on a
+		// queue that does not retry its executions.
+		queue := tq
+		if queue.opts.Retry.MaxAttempts < 2 {
+			queue.opts.Retry = DefaultFollowUpRetry
+		}
+		return queue.failed(result, instance, err)
+	}
+	*instance, err = instance.MoveTo(StateDone)
+	if err == nil && !instance.ResultFile().Exists() {
+		err = instance.touch()
+	}
+	if err == nil {
+		err = tq.finishKey(*instance)
+	}
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Error = err
+		return result
+	}
+	result.Outcome = OutcomeSucceeded
+	return result
+}
+
+// cancelled moves the claimed instance into cancelled and
+// reports it, along with the error the executor returned.
+func (tq TaskQueue) cancelled(result TaskResult, instance *TaskInstance, execErr error) TaskResult {
+	result.Outcome = OutcomeCancelled
+	result.Error = execErr
+	err := tq.markCancelled(instance)
+	if err != nil {
+		result.Outcome = OutcomeError
+		result.Error = errors.Join(execErr, err)
+	}
+	return result
+}
+
+// isHead is true unless the queue is FIFO and instance
+// is not at the head of it.
+func (tq TaskQueue) isHead(instance TaskInstance) bool {
+	if !tq.opts.FIFO {
+		return true
+	}
+	head, ok, err := tq.head()
+	return err == nil && ok && head.id == instance.id
+}
+
+// fail records execErr in the error file of the running instance and
+// decides by its kind what happens next. A skipped instance is moved to
+// done. If the error can be retried, the instance returns to pending to
+// be retried after the delay of the error or the retry policy. Otherwise
+// it is moved to failed.
+func (tq TaskQueue) fail(instance *TaskInstance, execErr error) (Outcome, error) {
+	taskErrors, err := instance.GetErrors()
+	if err != nil {
+		return OutcomeError, err
+	}
+	kind, delay := classify(execErr)
+	now := time.Now()
+	errMsg := TaskExecutionError{
+		Timestamp: now,
+		Error:     execErr.Error(),
+		Traceback: traceback(execErr),
+		Kind:      kind,
+	}
+	attempts := taskErrors.Count() + 1
+	retry := false
+	switch kind {
+	case ErrorTransient:
+		retry = tq.opts.Retry.ShouldRetry(attempts)
+		delay = tq.opts.Retry.Delay(attempts)
+	case ErrorRetryAfter:
+		retry = tq.opts.Retry.MaxAttempts < 1 || tq.opts.Retry.ShouldRetry(attempts)
+	}
+	if retry {
+		errMsg.RetryAt = now.Add(delay)
+	}
+	err = instance.AddError(errMsg)
+	if err != nil {
+		return OutcomeError, err
+	}
+
+	switch {
+	case kind == ErrorSkip:
+		*instance, err = instance.MoveTo(StateDone)
+		return OutcomeSkipped, err
+	case retry:
+		*instance, err = instance.MoveTo(StatePending)
+		return OutcomeRetrying, err
+	}
+	*instance, err = instance.MoveTo(StateFailed)
+	if errors.Is(execErr, ErrTaskTimeout) {
+		return OutcomeTimedOut, err
+	}
+	return OutcomeFailed, err
+}
+
+// executeTimeout runs the executor with the instance's timeout, or
+// else the queue's. An executor still running when the timeout
+// expires is abandoned, so it no longer holds up the runner.
+func (tq TaskQueue) executeTimeout(ctx context.Context, instance TaskInstance, data []byte) (any, error) {
+	meta, err := instance.GetMeta()
+	if err != nil {
+		return nil, err
+	}
+	timeout := tq.opts.Timeout
+	if meta.Timeout > 0 {
+		timeout = meta.Timeout
+	}
+	if timeout <= 0 {
+		return tq.call(ctx, data)
+	}
+
+	type outcome struct {
+		value any
+		err   error
+	}
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan outcome, 1)
+	go func() {
+		value, err := tq.call(execCtx, data)
+		done <- outcome{value, err}
+	}()
+	select {
+	case out := <-done:
+		if out.err == nil {
+			return out.value, nil
+		}
+		err = out.err
+	case <-execCtx.Done():
+		err = execCtx.Err()
+	}
+	if ctx.Err() == nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s", ErrTaskTimeout, timeout)
+	}
+	return nil, err
+}
+
+// call runs the executor, returning a PanicError if it panics.
+func (tq TaskQueue) call(ctx context.Context, data []byte) (value any, err error) {
+	defer recoverPanic(&err)
+	if task, ok := tq.task.(ResultTaskExecutor); ok {
+		return task.ExecuteResult(ctx, data)
+	}
+	return nil, tq.task.ExecuteContext(ctx, data)
+}
+
+func NewTaskQueue(master Path, name string, task TaskExecutor, opts ...QueueOption) (TaskQueue, error) {
+	return NewContextTaskQueue(master, name, ContextExecutor(task), opts...)
+}
+
+func NewResultTaskQueue(master Path, name string, task ResultTaskExecutor, opts ...QueueOption) (TaskQueue, error) {
+	return NewContextTaskQueue(master, name, ResultExecutor(task), opts...)
 }
 
-func NewTaskQueue(master Path, name string, task TaskExecutor) (TaskQueue, error) {
+func NewContextTaskQueue(master Path, name string, task ContextTaskExecutor, opts ...QueueOption) (TaskQueue, error) {
 	tq := TaskQueue{
 		root: master.Join(name),
 		name: name,
 		task: task,
+		opts: NewQueueOptions(opts...),
 	}
 	err := tq.Initialize()
 	if err != nil {
@@ -1,11 +1,14 @@
 package queue
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type TaskOptions struct {
@@ -70,8 +73,8 @@ func TestTaskQueue_CreateTaskInstance(t *testing.T) {
 
 	ti := tq.CreateTaskInstance()
 	assert.Equal(t, "concrete", ti.name)
-	assert.Equal(t, 15, len(ti.id), fmt.Sprintf("%s has a len of %d", ti.id, len(ti.id)))
-	assert.Equal(t, fmt.Sprintf("/localq/concrete/%s", ti.id), ti.root.String())
+	assert.Equal(t, 26, len(ti.id), fmt.Sprintf("%s has a len of %d", ti.id, len(ti.id)))
+	assert.Equal(t, fmt.Sprintf("/localq/concrete/pending/%s", ti.id), ti.root.String())
 	//assert.Equal(t, "*queue.ConcreteTask", reflect.TypeOf(ti.task).String())
 	assert.False(t, ti.IsLocked())
 }
@@ -169,4 +172,448 @@ func TestTaskQueue_Run(t *testing.T) {
 	assert.Equal(t, ti.root.String(), ti.String())
 	assert.False(t, ti.Exists())
 
+	done, err := tq.GetTaskInstancesIn(StateDone)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(done))
+	assert.Equal(t, ti.id, done[0].id)
+
+}
+
+func TestTaskQueue_RunError(t *testing.T) {
+
+	tq := MakeTaskQueue(true)
+
+	ti, err := tq.Run(TaskOptions{
+		Id:   1,
+		Name: "Hello!",
+	})
+	assert.EqualError(t, err, "ConcreteTask 1 failed")
+	assert.False(t, ti.Exists())
+
+	failed, err := tq.GetTaskInstancesIn(StateFailed)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(failed))
+	assert.True(t, failed[0].HasError())
+	assert.False(t, failed[0].IsLocked())
+
+}
+
+func TestTaskQueue_ExecuteTask(t *testing.T) {
+
+	tq := MakeTaskQueue(false)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeSucceeded, result.Outcome)
+	assert.Equal(t, "concrete", result.Queue)
+	assert.Equal(t, ti.id, result.Id)
+	assert.Nil(t, result.Error)
+	assert.True(t, result.Duration > 0)
+
+	// it has already been executed and moved out of pending.
+	result = tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeSkipped, result.Outcome)
+	assert.Nil(t, result.Error)
+
+}
+
+func TestTaskQueue_Migrate(t *testing.T) {
+
+	tq := MakeTaskQueue(false)
+
+	// lay out instances as earlier versions did.
+	legacy := func(id string) TaskInstance {
+		ti := TaskInstance{root: tq.root.Join(id), name: tq.name, id: id}
+		_ = ti.root.MkDirs()
+		_ = ti.TaskFile().Write([]byte(`{"id":1,"name":"Hello!"}`))
+		return ti
+	}
+	_ = legacy("aaaaaaaaaaaaaaa")
+	errored := legacy("bbbbbbbbbbbbbbb")
+	_ = errored.WriteError("failed", "")
+	stale := legacy("ccccccccccccccc")
+	_ = stale.LockFile().Write([]byte{})
+
+	err := tq.Migrate()
+	assert.Nil(t, err)
+
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pending))
+	for _, ti := range pending {
+		assert.True(t, ti.IsReady())
+		assert.False(t, ti.LockFile().Exists())
+	}
+
+	failed, err := tq.GetTaskInstancesIn(StateFailed)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(failed))
+	assert.Equal(t, "bbbbbbbbbbbbbbb", failed[0].id)
+	assert.True(t, failed[0].HasError())
+
+}
+
+func TestTaskQueue_MaxConcurrency(t *testing.T) {
+
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{},
+		WithMaxConcurrency(2),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, tq.Options().MaxConcurrency)
+
+	slotA, err := tq.AcquireSlot(false)
+	assert.Nil(t, err)
+	slotB, err := tq.AcquireSlot(false)
+	assert.Nil(t, err)
+
+	_, err = tq.AcquireSlot(false)
+	assert.ErrorIs(t, err, ErrQueueBusy)
+
+	// waiting for a slot stops with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = tq.AcquireSlotContext(ctx, true)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = tq.RunContext(ctx, TaskOptions{Id: 2, Name: "Hello!"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// with every slot taken the instance is left pending.
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeSkipped, result.Outcome)
+	assert.True(t, ti.IsReady())
+
+	err = slotA.Release()
+	assert.Nil(t, err)
+
+	result = tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeSucceeded, result.Outcome)
+
+	assert.Nil(t, slotB.Release())
+
+}
+
+func TestTaskQueue_Timeout(t *testing.T) {
+
+	task := &BlockingTask{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"blocking",
+		task,
+		WithTimeout(10*time.Millisecond),
+		WithMaxConcurrency(1),
+		WithRetry(RetryPolicy{MaxAttempts: 2}),
+	)
+	assert.Nil(t, err)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	// the executor does not return, but the runner records the
+	// timeout and moves on, releasing the lock and the slot.
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeRetrying, result.Outcome)
+	assert.ErrorIs(t, result.Error, ErrTaskTimeout)
+	assert.True(t, ti.IsReady())
+	assert.False(t, ti.IsLocked())
+	errors, err := ti.GetErrors()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, errors.Count())
+	assert.Equal(t, "task execution timed out after 10ms", errors.Errors[0].Error)
+	slot, err := tq.AcquireSlot(false)
+	assert.Nil(t, err)
+	assert.Nil(t, slot.Release())
+
+	// once out of attempts, it is failed.
+	result = tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeTimedOut, result.Outcome)
+	failed, err := tq.GetTaskInstancesIn(StateFailed)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(failed))
+	assert.False(t, failed[0].IsLocked())
+	status, err := tq.GetStatus(ti.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusFailed, status)
+
+	// an instance can be given longer than the queue allows.
+	ti, err = tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendWithTimeout(time.Hour))
+	assert.Nil(t, err)
+	meta, err := ti.GetMeta()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, meta.Timeout)
+
+	// release the abandoned executions, then the third one
+	// once it is well past the queue timeout.
+	task.release <- struct{}{}
+	task.release <- struct{}{}
+	go func() {
+		<-task.started
+		<-task.started
+		<-task.started
+		time.Sleep(50 * time.Millisecond)
+		task.release <- struct{}{}
+	}()
+	result = tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeSucceeded, result.Outcome)
+
+}
+
+func TestTaskQueue_Retry(t *testing.T) {
+
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{Errored: true},
+		WithRetry(RetryPolicy{MaxAttempts: 3}),
+	)
+	assert.Nil(t, err)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		result := tq.ExecuteTask(ti)
+		assert.Equal(t, OutcomeRetrying, result.Outcome)
+		assert.EqualError(t, result.Error, "ConcreteTask 1 failed")
+
+		// without a delay the instance is ready again at once.
+		assert.True(t, ti.IsReady())
+		errors, err := ti.GetErrors()
+		assert.Nil(t, err)
+		assert.Equal(t, attempt, errors.Count())
+	}
+
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeFailed, result.Outcome)
+	assert.False(t, ti.Exists())
+
+	failed, err := tq.GetTaskInstancesIn(StateFailed)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(failed))
+	errors, err := failed[0].GetErrors()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, errors.Count())
+	_, ok := failed[0].RetryAt()
+	assert.False(t, ok)
+
+}
+
+func TestTaskQueue_RetryDelay(t *testing.T) {
+
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{Errored: true},
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour}),
+	)
+	assert.Nil(t, err)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	result := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeRetrying, result.Outcome)
+
+	// the instance waits out its delay in pending.
+	assert.Equal(t, StatePending, ti.State())
+	assert.True(t, ti.Exists())
+	assert.False(t, ti.IsReady())
+	retryAt, ok := ti.RetryAt()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), retryAt, time.Minute)
+
+}
+
+func TestTaskQueue_SendAt(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	runAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	ti, err := tq.SendAt(TaskOptions{Id: 1, Name: "Hello!"}, runAt)
+	assert.Nil(t, err)
+
+	meta, err := ti.GetMeta()
+	assert.Nil(t, err)
+	assert.True(t, runAt.Equal(meta.RunAt))
+	dueAt, ok := ti.DueAt()
+	assert.True(t, ok)
+	assert.True(t, runAt.Equal(dueAt))
+
+	// not due, so runners leave it alone.
+	assert.False(t, ti.IsReady())
+	assert.Equal(t, OutcomeSkipped, tq.ExecuteTask(ti).Outcome)
+	assert.Equal(t, StatePending, ti.State())
+	assert.True(t, ti.Exists())
+
+	next, ok := tq.NextDue()
+	assert.True(t, ok)
+	assert.True(t, runAt.Equal(next))
+
+	ti, err = tq.SendAt(TaskOptions{Id: 2, Name: "Hello!"}, time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ti.IsReady())
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(ti).Outcome)
+}
+
+func TestTaskQueue_SendAfter(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	ti, err := tq.SendAfter(TaskOptions{Id: 1, Name: "Hello!"}, 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.False(t, ti.IsReady())
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, ti.IsReady())
+	_, ok := tq.NextDue()
+	assert.False(t, ok)
+
+	// Run waits for a delayed instance.
+	start := time.Now()
+	ti, err = tq.Run(TaskOptions{Id: 2, Name: "Hello!"}, SendWithDelay(50*time.Millisecond))
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	done, err := tq.GetTaskInstancesIn(StateDone)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(done))
+}
+
+func TestTaskQueue_Priority(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	priorities := []int{0, 5, -1, 10, 5}
+	for i, priority := range priorities {
+		_, err := tq.Send(TaskOptions{Id: i + 1, Name: "Hello!"}, SendWithPriority(priority))
+		assert.Nil(t, err)
+	}
+
+	tasks, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	order := []int{}
+	for _, task := range tasks {
+		order = append(order, task.Priority())
+	}
+	assert.Equal(t, []int{10, 5, 5, 0, -1}, order)
+
+	// the priority is part of the directory name, not the id.
+	top := tasks[0]
+	assert.Equal(t, fmt.Sprintf("%s.p10", top.id), top.TaskDir().Name())
+	assert.True(t, top.TaskFile().Exists())
+	found, err := tq.FindTaskInstance(StatePending, top.id)
+	assert.Nil(t, err)
+	assert.Equal(t, top.TaskDir().String(), found.TaskDir().String())
+
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(top).Outcome)
+	done, err := tq.FindTaskInstance(StateDone, top.id)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, done.Priority())
+
+	_, err = tq.FindTaskInstance(StatePending, top.id)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTaskQueue_SendOrder(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	// a task of an earlier version, with a nanoid id, that
+	// was sent before any of the others.
+	legacy := tq.LoadTaskInstance(tq.StateDir(StatePending).Join("zzzzzzzzzzzzzzz"))
+	assert.Nil(t, legacy.TaskDir().MkDirs())
+	assert.Nil(t, legacy.TaskFile().Write([]byte(`{"id": 1, "name": "Hello!"}`)))
+	assert.Nil(t, tq.root.fs.Chtimes(legacy.TaskFile().String(), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+
+	sent := []string{legacy.id}
+	for id := 2; id <= 20; id++ {
+		ti, err := tq.Send(TaskOptions{Id: id, Name: "Hello!"})
+		assert.Nil(t, err)
+		sent = append(sent, ti.id)
+	}
+
+	tasks, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	order := []string{}
+	for _, task := range tasks {
+		order = append(order, task.id)
+	}
+	assert.Equal(t, sent, order)
+}
+
+func TestTaskQueue_FIFO(t *testing.T) {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{Errored: true},
+		WithFIFO(),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, tq.Options().MaxConcurrency)
+
+	first, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	second, err := tq.Send(TaskOptions{Id: 2, Name: "Hello!"})
+	assert.Nil(t, err)
+	_, err = tq.SendAfter(TaskOptions{Id: 3, Name: "Hello!"}, time.Hour)
+	assert.Nil(t, err)
+
+	// only the head of the queue is ready.
+	ready, err := tq.ReadyTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ready))
+	assert.Equal(t, first.id, ready[0].id)
+	assert.Equal(t, OutcomeSkipped, tq.ExecuteTask(second).Outcome)
+
+	// a task run behind the head is not executed either.
+	run, err := tq.Run(TaskOptions{Id: 4, Name: "Hello!"})
+	assert.ErrorIs(t, err, ErrTaskSkipped)
+	assert.Equal(t, StatePending, run.State())
+	assert.Nil(t, run.Remove())
+
+	// while the head waits on a retry, the queue is held up.
+	assert.Equal(t, OutcomeRetrying, tq.ExecuteTask(first).Outcome)
+	ready, err = tq.ReadyTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ready))
+	assert.Equal(t, OutcomeSkipped, tq.ExecuteTask(second).Outcome)
+
+	// once it is dead-lettered, the next one is up.
+	_, err = first.Reset(false)
+	assert.Nil(t, err)
+	assert.Nil(t, first.WriteError("given up", ""))
+	_, err = first.MoveTo(StateFailed)
+	assert.Nil(t, err)
+	ready, err = tq.ReadyTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ready))
+	assert.Equal(t, second.id, ready[0].id)
+}
+
+func TestTaskQueue_FIFOWithPriority(t *testing.T) {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{},
+		WithFIFO(),
+	)
+	assert.Nil(t, err)
+
+	first, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	second, err := tq.Send(TaskOptions{Id: 2, Name: "Hello!"}, SendWithPriority(5))
+	assert.Nil(t, err)
+
+	// the priority does not jump the queue.
+	ready, err := tq.ReadyTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ready))
+	assert.Equal(t, first.id, ready[0].id)
+	assert.Equal(t, OutcomeSkipped, tq.ExecuteTask(second).Outcome)
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(first).Outcome)
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(second).Outcome)
 }
@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrorFilter selects errored task instances by their last error.
+type ErrorFilter func(TaskExecutionError) bool
+
+// ErrorContains matches errors whose message contains substr.
+func ErrorContains(substr string) ErrorFilter {
+	return func(err TaskExecutionError) bool {
+		return strings.Contains(err.Error, substr)
+	}
+}
+
+// ErrorBetween matches errors recorded from start up to, but
+// not including, end. A zero start or end leaves that side open.
+func ErrorBetween(start time.Time, end time.Time) ErrorFilter {
+	return func(err TaskExecutionError) bool {
+		if !start.IsZero() && err.Timestamp.Before(start) {
+			return false
+		}
+		return end.IsZero() || err.Timestamp.Before(end)
+	}
+}
+
+// RequeueErrored resets every errored task instance of the queue,
+// both those dead-lettered and those waiting in pending, and returns
+// the requeued instances. See TaskInstance.Reset for keepHistory.
+func (tq TaskQueue) RequeueErrored(keepHistory bool) ([]TaskInstance, error) {
+	return tq.RequeueWhere(nil, keepHistory)
+}
+
+// RequeueWhere resets the errored task instances of the queue whose
+// last error matches filter. A nil filter matches every error. Task
+// instances that are locked by a worker are left alone.
+func (tq TaskQueue) RequeueWhere(filter ErrorFilter, keepHistory bool) ([]TaskInstance, error) {
+	requeued := []TaskInstance{}
+	for _, state := range []TaskState{StatePending, StateFailed} {
+		tasks, err := tq.GetTaskInstancesIn(state)
+		if err != nil {
+			return requeued, err
+		}
+		for _, task := range tasks {
+			if !task.HasError() || task.IsLocked() {
+				continue
+			}
+			taskErrors, err := task.GetErrors()
+			if err != nil {
+				return requeued, err
+			}
+			last, ok := taskErrors.Last()
+			if !ok || (filter != nil && !filter(last)) {
+				continue
+			}
+			task, err = task.Reset(keepHistory)
+			if errors.Is(err, ErrTaskLocked) || errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrTaskNotErrored) {
+				// claimed, moved or reset by somebody else meanwhile.
+				continue
+			}
+			if err != nil {
+				return requeued, err
+			}
+			requeued = append(requeued, task)
+		}
+	}
+	return requeued, nil
+}
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestErrorFilter(t *testing.T) {
+	now := time.Now()
+	err := TaskExecutionError{Timestamp: now, Error: "connection refused"}
+
+	assert.True(t, ErrorContains("refused")(err))
+	assert.False(t, ErrorContains("timeout")(err))
+
+	assert.True(t, ErrorBetween(now.Add(-time.Minute), now.Add(time.Minute))(err))
+	assert.True(t, ErrorBetween(time.Time{}, now.Add(time.Minute))(err))
+	assert.True(t, ErrorBetween(now, time.Time{})(err))
+	assert.False(t, ErrorBetween(now.Add(time.Minute), time.Time{})(err))
+	assert.False(t, ErrorBetween(time.Time{}, now)(err))
+}
+
+func TestTaskQueue_RequeueErrored(t *testing.T) {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{Errored: true},
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour}),
+	)
+	assert.Nil(t, err)
+
+	// one instance waiting on a retry, one dead-lettered.
+	waiting, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	assert.Equal(t, OutcomeRetrying, tq.ExecuteTask(waiting).Outcome)
+	dead, err := tq.Send(TaskOptions{Id: 2, Name: "Hello!"})
+	assert.Nil(t, err)
+	assert.Nil(t, dead.WriteError("ConcreteTask 2 failed", ""))
+	_, err = dead.MoveTo(StateFailed)
+	assert.Nil(t, err)
+	_, err = tq.DeadLetter(dead.id)
+	assert.Nil(t, err)
+
+	_, err = tq.Send(TaskOptions{Id: 3, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	requeued, err := tq.RequeueErrored(true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(requeued))
+
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(pending))
+	for _, task := range pending {
+		assert.True(t, task.IsReady())
+	}
+}
+
+func TestTaskQueue_RequeueWhere(t *testing.T) {
+	tq := MakeTaskQueue(true)
+	for id := 1; id <= 2; id++ {
+		ti, err := tq.Send(TaskOptions{Id: id, Name: "Hello!"})
+		assert.Nil(t, err)
+		tq.ExecuteTask(ti)
+	}
+
+	requeued, err := tq.RequeueWhere(ErrorContains("ConcreteTask 2"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(requeued))
+
+	data, err := requeued[0].TaskFile().Read()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"id": 2, "name": "Hello!"}`, string(data))
+
+	letters, err := tq.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(letters))
+
+	requeued, err = tq.RequeueWhere(ErrorBetween(time.Now(), time.Time{}), false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(requeued))
+}
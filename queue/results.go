@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoResult is returned when fetching the result of a task
+// instance that has not, or not yet, succeeded.
+var ErrNoResult = errors.New("task has no result")
+
+// hasResults is true if the queue's executor produces results.
+func (tq TaskQueue) hasResults() bool {
+	_, ok := tq.task.(ResultTaskExecutor)
+	return ok
+}
+
+// writeResult stores the result of a successful execution
+// as JSON in the task result file.
+func (ti TaskInstance) writeResult(value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid task result: %w", err))
+	}
+	return ti.ResultFile().Write(data)
+}
+
+// GetResult reads the JSON result of the task. Tasks executed without
+// a ResultTaskExecutor have no result.
+func (ti TaskInstance) GetResult() ([]byte, error) {
+	if !ti.ResultFile().Exists() {
+		return nil, fmt.Errorf("%w: %s", ErrNoResult, ti.id)
+	}
+	return ti.ResultFile().Read()
+}
+
+// GetResult reads the JSON result of the succeeded task instance id,
+// which is kept by an instance dead-lettered because its follow ups
+// could not be sent. ErrNoResult is returned if it has not succeeded,
+// it was executed without a ResultTaskExecutor, or it has been purged.
+// Use ReadTaskData to decode it.
+func (tq TaskQueue) GetResult(id string) ([]byte, error) {
+	for _, state := range []TaskState{StateDone, StateFailed} {
+		instance, err := tq.FindTaskInstance(state, id)
+		if err == nil {
+			return instance.GetResult()
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoResult, id)
+}
+
+// finishedAt returns when a finished task instance was last written
+// to: its result, or its error file for a skipped instance, or else
+// its task folder, which is touched when it is moved into done.
+func (ti TaskInstance) finishedAt() (time.Time, error) {
+	for _, file := range []Path{ti.ResultFile(), ti.ErrorFile()} {
+		if file.Exists() {
+			return file.ModTime()
+		}
+	}
+	return ti.TaskDir().ModTime()
+}
+
+// touch sets the modification time of the task folder to now.
+func (ti TaskInstance) touch() error {
+	now := time.Now()
+	return ti.root.fs.Chtimes(ti.root.String(), now, now)
+}
+
+// PurgeResults deletes the task instances in done that finished
+// longer ago than the queue's result retention, and returns how many
+// were removed. Nothing is purged if the queue keeps results forever.
+func (tq TaskQueue) PurgeResults() (int, error) {
+	if tq.opts.ResultRetention < 0 {
+		return 0, nil
+	}
+	tasks, err := tq.GetTaskInstancesIn(StateDone)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	var errs []error
+	for _, task := range tasks {
+		finishedAt, err := task.finishedAt()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if time.Since(finishedAt) < tq.opts.ResultRetention {
+			continue
+		}
+		err = task.Remove()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("purge %s: %w", task.id, err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
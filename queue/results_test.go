@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+type SumTask struct{}
+
+func (t SumTask) Assert(opt any) error {
+	_, ok := opt.([]int)
+	if !ok {
+		return fmt.Errorf("expected []int, got %T", opt)
+	}
+	return nil
+}
+
+func (t SumTask) ExecuteResult(ctx context.Context, data []byte) (any, error) {
+	numbers, err := ReadTaskData[[]int](data)
+	if err != nil {
+		return nil, err
+	}
+	if len(numbers) == 0 {
+		// channels cannot be stored as a result.
+		return make(chan int), nil
+	}
+	sum := 0
+	for _, n := range numbers {
+		sum += n
+	}
+	return map[string]int{"sum": sum}, nil
+}
+
+func MakeSumQueue(t *testing.T, opts ...QueueOption) TaskQueue {
+	tq, err := NewResultTaskQueue(NewPath("/localq", afero.NewMemMapFs(), 07777), "sum", SumTask{}, opts...)
+	assert.Nil(t, err)
+	return tq
+}
+
+func TestTaskQueue_GetResult(t *testing.T) {
+	tq := MakeSumQueue(t)
+
+	ti, err := tq.Send([]int{1, 2, 3})
+	assert.Nil(t, err)
+	_, err = tq.GetResult(ti.id)
+	assert.ErrorIs(t, err, ErrNoResult)
+
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(ti).Outcome)
+	data, err := tq.GetResult(ti.id)
+	assert.Nil(t, err)
+	result, err := ReadTaskData[map[string]int](data)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, result["sum"])
+
+	// a result that cannot be stored fails the task for good.
+	ti, err = tq.Send([]int{})
+	assert.Nil(t, err)
+	result2 := tq.ExecuteTask(ti)
+	assert.Equal(t, OutcomeFailed, result2.Outcome)
+	assert.Contains(t, result2.Error.Error(), "invalid task result")
+	_, err = tq.GetResult(ti.id)
+	assert.ErrorIs(t, err, ErrNoResult)
+}
+
+func TestTaskQueue_GetResultWithoutResult(t *testing.T) {
+	tq := MakeTaskQueue(false)
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	assert.Equal(t, OutcomeSucceeded, tq.ExecuteTask(ti).Outcome)
+
+	_, err = tq.GetResult(ti.id)
+	assert.ErrorIs(t, err, ErrNoResult)
+	done, err := tq.FindTaskInstance(StateDone, ti.id)
+	assert.Nil(t, err)
+	assert.False(t, done.ResultFile().Exists())
+
+	// it is purged once it has been in done for long enough.
+	purged, err := tq.PurgeResults()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+	past := time.Now().Add(-2 * DefaultResultRetention)
+	assert.Nil(t, tq.root.fs.Chtimes(done.TaskDir().String(), past, past))
+	purged, err = tq.PurgeResults()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+}
+
+func TestTaskQueue_PurgeResults(t *testing.T) {
+	tq := MakeSumQueue(t, WithResultRetention(time.Hour))
+
+	old, err := tq.Send([]int{1})
+	assert.Nil(t, err)
+	tq.ExecuteTask(old)
+	recent, err := tq.Send([]int{2})
+	assert.Nil(t, err)
+	tq.ExecuteTask(recent)
+
+	done, err := tq.FindTaskInstance(StateDone, old.id)
+	assert.Nil(t, err)
+	past := time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, tq.root.fs.Chtimes(done.ResultFile().String(), past, past))
+
+	purged, err := tq.PurgeResults()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = tq.GetResult(old.id)
+	assert.ErrorIs(t, err, ErrNoResult)
+	_, err = tq.FindTaskInstance(StateDone, old.id)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = tq.GetResult(recent.id)
+	assert.Nil(t, err)
+
+	// results are kept forever with a negative retention.
+	tq = MakeSumQueue(t, WithResultRetention(-1))
+	ti, err := tq.Send([]int{1})
+	assert.Nil(t, err)
+	tq.ExecuteTask(ti)
+	done, err = tq.FindTaskInstance(StateDone, ti.id)
+	assert.Nil(t, err)
+	assert.Nil(t, tq.root.fs.Chtimes(done.ResultFile().String(), past, past))
+	purged, err = tq.PurgeResults()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+}
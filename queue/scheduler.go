@@ -0,0 +1,294 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSchedulerLocked is returned by Scheduler.Tick when another
+// scheduler is firing the schedules of the same root.
+var ErrSchedulerLocked = errors.New("scheduler is locked by another owner")
+
+const (
+	DefaultMisfireThreshold = time.Minute
+	// scheduleDir is the directory under the master root
+	// holding the scheduler lock and last fired times.
+	scheduleDir = ".schedule"
+	// maxCatchUp bounds the missed ticks looked at in one go.
+	maxCatchUp = 1000
+)
+
+// CatchUp decides what happens to the ticks of a schedule that were
+// missed, because no scheduler was running or it fell behind.
+type CatchUp int
+
+const (
+	// CatchUpOnce sends a single task instance for all missed ticks.
+	CatchUpOnce CatchUp = iota
+	// CatchUpSkip drops missed ticks.
+	CatchUpSkip
+	// CatchUpAll sends a task instance for every missed tick.
+	CatchUpAll
+)
+
+// ScheduleEntry sends a task instance with fixed arguments
+// to a registered queue whenever its schedule fires.
+type ScheduleEntry struct {
+	// Name identifies the entry, and its last fired time on disk.
+	Name        string
+	Queue       string
+	Schedule    Schedule
+	Args        any
+	SendOptions []SendOption
+	CatchUp     CatchUp
+}
+
+// SchedulerOptions configure a Scheduler. Zero values are
+// replaced with their defaults.
+type SchedulerOptions struct {
+	// PollInterval is how often the scheduler checks for due ticks.
+	PollInterval time.Duration
+	// MisfireThreshold is how late a tick can be sent before it
+	// counts as missed and is handled by the entry's CatchUp.
+	MisfireThreshold time.Duration
+	// OnError, if set, is called with the errors met by Run.
+	OnError func(error)
+}
+
+// Scheduler sends task instances to the queues of a MasterQ on
+// cron or interval schedules. Any number of schedulers can be run
+// against the same root: a lock file makes sure only one of them
+// fires at a time, and the last fired time of each entry is kept
+// on disk, so a restarted or new scheduler carries on where the
+// previous one left off.
+type Scheduler struct {
+	master  *MasterQ
+	opts    SchedulerOptions
+	mu      sync.Mutex
+	entries map[string]ScheduleEntry
+	lock    *FileLock
+}
+
+type scheduleState struct {
+	LastFired time.Time `json:"last_fired"`
+}
+
+func NewScheduler(master *MasterQ, opts SchedulerOptions) *Scheduler {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.MisfireThreshold <= 0 {
+		opts.MisfireThreshold = DefaultMisfireThreshold
+	}
+	return &Scheduler{
+		master:  master,
+		opts:    opts,
+		entries: make(map[string]ScheduleEntry),
+	}
+}
+
+// Add registers a schedule entry. The entry's queue must be
+// registered with the master, and its name must be unique.
+func (s *Scheduler) Add(entry ScheduleEntry) error {
+	if entry.Name == "" || strings.ContainsAny(entry.Name, `/\`) || strings.HasPrefix(entry.Name, ".") {
+		return fmt.Errorf("invalid schedule name '%s'", entry.Name)
+	}
+	if entry.Schedule == nil {
+		return fmt.Errorf("schedule '%s' has no schedule", entry.Name)
+	}
+	if !s.master.Has(entry.Queue) {
+		return fmt.Errorf("task '%s' is not registered", entry.Queue)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.entries[entry.Name]
+	if ok {
+		return fmt.Errorf("schedule '%s' is already registered", entry.Name)
+	}
+	s.entries[entry.Name] = entry
+	return nil
+}
+
+// Run fires the schedules until ctx is cancelled. While another
+// scheduler holds the lock, Run waits to take over from it.
+func (s *Scheduler) Run(ctx context.Context) error {
+	defer s.Close()
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := s.Tick()
+		if err != nil && !errors.Is(err, ErrSchedulerLocked) && s.opts.OnError != nil {
+			s.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick sends a task instance for each entry that is due and returns
+// how many were sent. The first Tick takes the scheduler lock, which
+// is kept until Close. ErrSchedulerLocked is returned if another
+// scheduler holds it.
+func (s *Scheduler) Tick() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock == nil {
+		dir := s.master.root.Join(scheduleDir)
+		err := dir.MkDirs()
+		if err != nil {
+			return 0, err
+		}
+		lock := NewFileLock(dir.fs, dir.Join("scheduler.lock").String())
+		err = lock.TryAcquire()
+		if errors.Is(err, ErrLocked) {
+			return 0, ErrSchedulerLocked
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.lock = lock
+	}
+
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	sent := 0
+	var errs []error
+	for _, name := range names {
+		n, err := s.fire(s.entries[name], now)
+		sent += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %s: %w", name, err))
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// Close releases the scheduler lock, letting another scheduler take over.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock == nil {
+		return nil
+	}
+	err := s.lock.Release()
+	s.lock = nil
+	return err
+}
+
+// fire sends the task instances of the ticks of entry that have
+// come since it last fired. An entry that has never fired starts
+// its schedule from now.
+func (s *Scheduler) fire(entry ScheduleEntry, now time.Time) (int, error) {
+	state, ok, err := s.readState(entry.Name)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, s.writeState(entry.Name, scheduleState{LastFired: now})
+	}
+
+	ticks := []time.Time{}
+	next := entry.Schedule.Next(state.LastFired)
+	for !next.IsZero() && !next.After(now) && len(ticks) < maxCatchUp {
+		ticks = append(ticks, next)
+		next = entry.Schedule.Next(next)
+	}
+	if len(ticks) == 0 {
+		return 0, nil
+	}
+
+	due := []time.Time{}
+	missed := []time.Time{}
+	for _, tick := range ticks {
+		if now.Sub(tick) > s.opts.MisfireThreshold {
+			missed = append(missed, tick)
+		} else {
+			due = append(due, tick)
+		}
+	}
+	switch entry.CatchUp {
+	case CatchUpAll:
+		due = ticks
+	case CatchUpOnce:
+		if len(due) == 0 {
+			due = missed[len(missed)-1:]
+		}
+	}
+
+	queue, err := s.master.Get(entry.Queue)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, tick := range due {
+		// a tick sent again after a crash, before it was recorded,
+		// is refused as a duplicate of the instance sent for it.
+		opts := append([]SendOption{}, entry.SendOptions...)
+		opts = append(opts, SendWithKey(tickKey(entry, tick)))
+		_, err = queue.Send(entry.Args, opts...)
+		if err != nil && !errors.Is(err, ErrDuplicateTask) {
+			return sent, err
+		}
+		if err == nil {
+			sent++
+		}
+		err = s.writeState(entry.Name, scheduleState{LastFired: tick})
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, s.writeState(entry.Name, scheduleState{LastFired: ticks[len(ticks)-1]})
+}
+
+// tickKey returns the idempotency key of the
+// task instance sent for a tick of entry.
+func tickKey(entry ScheduleEntry, tick time.Time) string {
+	return fmt.Sprintf("schedule/%s/%s", entry.Name, tick.UTC().Format(time.RFC3339Nano))
+}
+
+// LastFired returns the time of the last tick the named entry fired
+// for, as recorded on disk. It is false if the entry never fired.
+func (s *Scheduler) LastFired(name string) (time.Time, bool, error) {
+	state, ok, err := s.readState(name)
+	return state.LastFired, ok, err
+}
+
+func (s *Scheduler) stateFile(name string) Path {
+	return s.master.root.Join(scheduleDir, fmt.Sprintf("%s.json", name))
+}
+
+func (s *Scheduler) readState(name string) (scheduleState, bool, error) {
+	state := scheduleState{}
+	file := s.stateFile(name)
+	if !file.Exists() {
+		return state, false, nil
+	}
+	data, err := file.Read()
+	if err != nil {
+		return state, false, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err == nil, err
+}
+
+func (s *Scheduler) writeState(name string, state scheduleState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.stateFile(name).Write(data)
+}
@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func MakeScheduler(t *testing.T, root string) (*MasterQ, *Scheduler) {
+	master, err := New(root, afero.NewMemMapFs(), 0777)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		delete(globalQ, master.root.String())
+	})
+	err = master.Register(&ConcreteTask{}, "concrete")
+	assert.Nil(t, err)
+	return master, NewScheduler(master, SchedulerOptions{})
+}
+
+func pendingCount(t *testing.T, master *MasterQ) int {
+	tasks, err := master.Enqueue("concrete").GetTaskInstances()
+	assert.Nil(t, err)
+	return len(tasks)
+}
+
+func TestScheduler_Add(t *testing.T) {
+	_, scheduler := MakeScheduler(t, "/scheduler/add")
+	entry := ScheduleEntry{Name: "hourly", Queue: "concrete", Schedule: Every(time.Hour)}
+
+	assert.Nil(t, scheduler.Add(entry))
+	assert.EqualError(t, scheduler.Add(entry), "schedule 'hourly' is already registered")
+
+	entry.Name = "../escape"
+	assert.NotNil(t, scheduler.Add(entry))
+	entry.Name = "missing"
+	entry.Queue = "missing"
+	assert.EqualError(t, scheduler.Add(entry), "task 'missing' is not registered")
+	entry.Queue = "concrete"
+	entry.Schedule = nil
+	assert.NotNil(t, scheduler.Add(entry))
+}
+
+func TestScheduler_Tick(t *testing.T) {
+	master, scheduler := MakeScheduler(t, "/scheduler/tick")
+	defer scheduler.Close()
+	err := scheduler.Add(ScheduleEntry{
+		Name:     "hourly",
+		Queue:    "concrete",
+		Schedule: Every(time.Hour),
+		Args:     TaskOptions{Id: 1, Name: "Hello!"},
+	})
+	assert.Nil(t, err)
+
+	// the first tick starts the schedule.
+	sent, err := scheduler.Tick()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, sent)
+	lastFired, ok, err := scheduler.LastFired("hourly")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// an hour later it fires once.
+	err = scheduler.writeState("hourly", scheduleState{LastFired: lastFired.Add(-time.Hour)})
+	assert.Nil(t, err)
+	sent, err = scheduler.Tick()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, sent)
+	sent, err = scheduler.Tick()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 1, pendingCount(t, master))
+
+	// a tick sent before a crash kept it from being
+	// recorded is not sent again.
+	err = scheduler.writeState("hourly", scheduleState{LastFired: lastFired.Add(-time.Hour)})
+	assert.Nil(t, err)
+	sent, err = scheduler.Tick()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 1, pendingCount(t, master))
+	fired, _, err := scheduler.LastFired("hourly")
+	assert.Nil(t, err)
+	assert.True(t, fired.After(lastFired.Add(-time.Hour)))
+
+	tasks, err := master.Enqueue("concrete").GetTaskInstances()
+	assert.Nil(t, err)
+	data, err := tasks[0].TaskFile().Read()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"id": 1, "name": "Hello!"}`, string(data))
+}
+
+func TestScheduler_CatchUp(t *testing.T) {
+	cases := []struct {
+		catchUp CatchUp
+		sent    int
+	}{
+		{CatchUpOnce, 1},
+		{CatchUpSkip, 0},
+		{CatchUpAll, 5},
+	}
+	for _, c := range cases {
+		master, scheduler := MakeScheduler(t, fmt.Sprintf("/scheduler/catchup/%d", c.catchUp))
+		err := scheduler.Add(ScheduleEntry{
+			Name:     "hourly",
+			Queue:    "concrete",
+			Schedule: Every(time.Hour),
+			Args:     TaskOptions{Id: 1, Name: "Hello!"},
+			CatchUp:  c.catchUp,
+		})
+		assert.Nil(t, err)
+
+		// five ticks were missed while no scheduler was running.
+		lastFired := time.Now().Add(-5*time.Hour - 30*time.Minute)
+		err = scheduler.writeState("hourly", scheduleState{LastFired: lastFired})
+		assert.Nil(t, err)
+
+		sent, err := scheduler.Tick()
+		assert.Nil(t, err)
+		assert.Equal(t, c.sent, sent, c.catchUp)
+		assert.Equal(t, c.sent, pendingCount(t, master))
+
+		// the missed ticks are done with, whatever the policy.
+		fired, _, err := scheduler.LastFired("hourly")
+		assert.Nil(t, err)
+		assert.Equal(t, lastFired.Truncate(time.Second).Add(5*time.Hour), fired.Local())
+		sent, err = scheduler.Tick()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Nil(t, scheduler.Close())
+	}
+}
+
+func TestScheduler_Lock(t *testing.T) {
+	master, first := MakeScheduler(t, "/scheduler/lock")
+	second := NewScheduler(master, SchedulerOptions{})
+
+	_, err := first.Tick()
+	assert.Nil(t, err)
+	_, err = second.Tick()
+	assert.ErrorIs(t, err, ErrSchedulerLocked)
+
+	// once the first scheduler stops, the second takes over.
+	assert.Nil(t, first.Close())
+	_, err = second.Tick()
+	assert.Nil(t, err)
+	assert.Nil(t, second.Close())
+}
+
+func TestScheduler_Run(t *testing.T) {
+	master, scheduler := MakeScheduler(t, "/scheduler/run")
+	scheduler.opts.PollInterval = 10 * time.Millisecond
+	err := scheduler.Add(ScheduleEntry{
+		Name:     "second",
+		Queue:    "concrete",
+		Schedule: Every(time.Second),
+		Args:     TaskOptions{Id: 1, Name: "Hello!"},
+	})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, scheduler.Run(ctx))
+	count := pendingCount(t, master)
+	assert.True(t, count >= 2 && count <= 3, count)
+
+	// Run released the lock on its way out.
+	assert.False(t, IsFileLocked(master.fs, master.root.Join(scheduleDir, "scheduler.lock").String()))
+}
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// TaskStatus is where a task instance is in its life. It is computed
+// from the state directory the instance is in and the files in it.
+type TaskStatus string
+
+const (
+	// StatusPending instances are waiting to be executed.
+	StatusPending TaskStatus = "pending"
+	// StatusScheduled instances were sent to run at a later time.
+	StatusScheduled TaskStatus = "scheduled"
+	// StatusRunning instances are being executed.
+	StatusRunning TaskStatus = "running"
+	// StatusRetrying instances failed and are waiting to be retried.
+	StatusRetrying TaskStatus = "retrying"
+	// StatusSucceeded instances are done.
+	StatusSucceeded TaskStatus = "succeeded"
+	// StatusFailed instances are dead-lettered.
+	StatusFailed TaskStatus = "failed"
+	// StatusCancelled instances were cancelled before they finished.
+	StatusCancelled TaskStatus = "cancelled"
+	// StatusExpired instances expired before they were executed.
+	StatusExpired TaskStatus = "expired"
+)
+
+// statusStates maps each status to the state directory
+// holding the instances with that status.
+var statusStates = map[TaskStatus]TaskState{
+	StatusPending:   StatePending,
+	StatusScheduled: StatePending,
+	StatusRetrying:  StatePending,
+	StatusRunning:   StateRunning,
+	StatusSucceeded: StateDone,
+	StatusFailed:    StateFailed,
+	StatusExpired:   StateExpired,
+	StatusCancelled: StateCancelled,
+}
+
+// IsFinished is true for the statuses an instance
+// does not leave by itself.
+func (s TaskStatus) IsFinished() bool {
+	switch s {
+	case StatusSucceeded, StatusFailed, StatusCancelled, StatusExpired:
+		return true
+	}
+	return false
+}
+
+// Status returns the status of the task.
+func (ti TaskInstance) Status() TaskStatus {
+	switch ti.State() {
+	case StateRunning:
+		return StatusRunning
+	case StateDone:
+		return StatusSucceeded
+	case StateFailed:
+		return StatusFailed
+	case StateExpired:
+		return StatusExpired
+	case StateCancelled:
+		return StatusCancelled
+	}
+	if ti.HasError() {
+		return StatusRetrying
+	}
+	runAt, ok := ti.RunAt()
+	if ok && time.Now().Before(runAt) {
+		return StatusScheduled
+	}
+	return StatusPending
+}
+
+// Lookup returns the task instance id of the queue,
+// whatever state it is in.
+func (tq TaskQueue) Lookup(id string) (TaskInstance, error) {
+	// an instance moving between state directories can be missed by
+	// a single pass over them, so only a few misses in a row count.
+	for pass := 0; pass < 3; pass++ {
+		for _, state := range taskStates {
+			instance, err := tq.FindTaskInstance(state, id)
+			if err == nil {
+				return instance, nil
+			}
+		}
+	}
+	return TaskInstance{}, &os.PathError{Op: "lookup", Path: tq.root.Join(id).String(), Err: os.ErrNotExist}
+}
+
+// GetStatus returns the status of the task instance id.
+func (tq TaskQueue) GetStatus(id string) (TaskStatus, error) {
+	instance, err := tq.Lookup(id)
+	if err != nil {
+		return "", err
+	}
+	return instance.Status(), nil
+}
+
+// ListByStatus returns the task instances of the queue with any
+// of the given statuses, in the order of the statuses given.
+func (tq TaskQueue) ListByStatus(statuses ...TaskStatus) ([]TaskInstance, error) {
+	instances := []TaskInstance{}
+	listed := map[TaskState][]TaskInstance{}
+	for _, status := range statuses {
+		state, ok := statusStates[status]
+		if !ok {
+			continue
+		}
+		tasks, ok := listed[state]
+		if !ok {
+			var err error
+			tasks, err = tq.GetTaskInstancesIn(state)
+			if err != nil {
+				return instances, err
+			}
+			listed[state] = tasks
+		}
+		for _, task := range tasks {
+			if task.Status() == status {
+				instances = append(instances, task)
+			}
+		}
+	}
+	return instances, nil
+}
+
+// Lookup returns the task instance id from whichever
+// registered queue holds it.
+func (q *MasterQ) Lookup(id string) (TaskInstance, error) {
+	for _, name := range q.Names() {
+		instance, err := q.tasks[name].Lookup(id)
+		if err == nil {
+			return instance, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return instance, err
+		}
+	}
+	return TaskInstance{}, &os.PathError{Op: "lookup", Path: q.root.Join(id).String(), Err: os.ErrNotExist}
+}
+
+// ListByStatus returns the task instances of every registered
+// queue with any of the given statuses.
+func (q *MasterQ) ListByStatus(statuses ...TaskStatus) ([]TaskInstance, error) {
+	instances := []TaskInstance{}
+	var errs []error
+	for _, name := range q.Names() {
+		tasks, err := q.tasks[name].ListByStatus(statuses...)
+		instances = append(instances, tasks...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return instances, errors.Join(errs...)
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTaskInstance_Status(t *testing.T) {
+	tq, err := NewTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 07777),
+		"concrete",
+		&ConcreteTask{Errored: true},
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour}),
+	)
+	assert.Nil(t, err)
+
+	pending, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPending, pending.Status())
+
+	scheduled, err := tq.SendAfter(TaskOptions{Id: 2, Name: "Hello!"}, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusScheduled, scheduled.Status())
+
+	claimed, err := pending.Claim()
+	assert.Nil(t, err)
+	assert.Equal(t, StatusRunning, claimed.Status())
+	assert.Nil(t, claimed.ReleaseLock())
+	_, err = claimed.MoveTo(StatePending)
+	assert.Nil(t, err)
+
+	tq.ExecuteTask(pending)
+	assert.Equal(t, StatusRetrying, pending.Status())
+	status, err := tq.GetStatus(pending.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusRetrying, status)
+
+	failed, err := pending.MoveTo(StateFailed)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusFailed, failed.Status())
+	assert.True(t, failed.Status().IsFinished())
+	assert.False(t, StatusRetrying.IsFinished())
+
+	_, err = tq.GetStatus("missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTaskQueue_ListByStatus(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	done, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	tq.ExecuteTask(done)
+	pending, err := tq.Send(TaskOptions{Id: 2, Name: "Hello!"})
+	assert.Nil(t, err)
+	scheduled, err := tq.SendAfter(TaskOptions{Id: 3, Name: "Hello!"}, time.Hour)
+	assert.Nil(t, err)
+
+	tasks, err := tq.ListByStatus(StatusScheduled)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tasks))
+	assert.Equal(t, scheduled.id, tasks[0].id)
+
+	tasks, err = tq.ListByStatus(StatusSucceeded, StatusPending)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tasks))
+	assert.Equal(t, done.id, tasks[0].id)
+	assert.Equal(t, pending.id, tasks[1].id)
+
+	found, err := tq.Lookup(done.id)
+	assert.Nil(t, err)
+	assert.Equal(t, StateDone, found.State())
+}
+
+func TestMasterQ_Lookup(t *testing.T) {
+	master, err := New("/status/lookup", afero.NewMemMapFs(), 0777)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		delete(globalQ, master.root.String())
+	})
+	assert.Nil(t, master.Register(&ConcreteTask{}, "first"))
+	assert.Nil(t, master.Register(&ConcreteTask{}, "second"))
+
+	first, err := master.Enqueue("first").Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	second, err := master.Enqueue("second").Send(TaskOptions{Id: 2, Name: "Hello!"})
+	assert.Nil(t, err)
+	master.Enqueue("second").ExecuteTask(second)
+
+	found, err := master.Lookup(second.id)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", found.name)
+	assert.Equal(t, StatusSucceeded, found.Status())
+	_, err = master.Lookup("missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	tasks, err := master.ListByStatus(StatusPending, StatusSucceeded)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tasks))
+	assert.Equal(t, first.id, tasks[0].id)
+}
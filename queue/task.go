@@ -1,8 +1,14 @@
 package queue
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,6 +19,73 @@ type TaskExecutor interface {
 	Execute([]byte) error
 }
 
+// ContextTaskExecutor is a TaskExecutor whose execution can be
+// cancelled, or given a deadline, through its context.
+type ContextTaskExecutor interface {
+	Assert(any) error
+	ExecuteContext(ctx context.Context, data []byte) error
+}
+
+// ContextExecutor adapts a TaskExecutor to a ContextTaskExecutor.
+// Executors that already implement ExecuteContext are returned as
+// is. Otherwise Execute is only called if ctx is not yet done, as
+// it cannot be interrupted once started.
+//
+//nolint:ireturn
+func ContextExecutor(task TaskExecutor) ContextTaskExecutor {
+	if ctxTask, ok := task.(ContextTaskExecutor); ok {
+		return ctxTask
+	}
+	return contextAdapter{task}
+}
+
+type contextAdapter struct {
+	TaskExecutor
+}
+
+func (a contextAdapter) ExecuteContext(ctx context.Context, data []byte) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	return a.Execute(data)
+}
+
+// executorAdapter presents a ContextTaskExecutor as a
+// TaskExecutor that runs without a deadline.
+type executorAdapter struct {
+	ContextTaskExecutor
+}
+
+func (a executorAdapter) Execute(data []byte) error {
+	return a.ExecuteContext(context.Background(), data)
+}
+
+// ResultTaskExecutor is a ContextTaskExecutor that produces a result.
+// The result of a successful execution is stored as JSON alongside the
+// task instance in done, where it can be fetched by the task id.
+type ResultTaskExecutor interface {
+	Assert(any) error
+	ExecuteResult(ctx context.Context, data []byte) (any, error)
+}
+
+// ResultExecutor adapts a ResultTaskExecutor to a ContextTaskExecutor
+// that the queue recognises and stores the results of.
+//
+//nolint:ireturn
+func ResultExecutor(task ResultTaskExecutor) ContextTaskExecutor {
+	return resultAdapter{task}
+}
+
+type resultAdapter struct {
+	ResultTaskExecutor
+}
+
+func (a resultAdapter) ExecuteContext(ctx context.Context, data []byte) error {
+	_, err := a.ExecuteResult(ctx, data)
+	return err
+}
+
 //nolint:ireturn
 func ReadTaskData[T any](jsonData []byte) (T, error) {
 	var opts T
@@ -23,10 +96,41 @@ func ReadTaskData[T any](jsonData []byte) (T, error) {
 	return opts, nil
 }
 
+// TaskMeta holds the per instance settings given when a task was
+// sent. It is kept in the task directory next to the task file.
+type TaskMeta struct {
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// RunAt is the time before which the task is not executed.
+	RunAt time.Time `json:"run_at,omitempty"`
+	// Priority orders the task before those with a lower one.
+	Priority int `json:"priority,omitempty"`
+	// ExpiresAt is the time after which the task is no
+	// longer worth executing.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// Key is the idempotency key the task was sent with.
+	Key string `json:"key,omitempty"`
+	// FollowUps are the task instances sent once the task succeeds.
+	FollowUps []FollowUp `json:"follow_ups,omitempty"`
+	// unique asks Send to derive Key from the task arguments.
+	unique bool
+}
+
+// IsZero is true if no setting has been given.
+func (m TaskMeta) IsZero() bool {
+	return m.Timeout == 0 && m.RunAt.IsZero() && m.Priority == 0 &&
+		m.ExpiresAt.IsZero() && m.Key == "" && len(m.FollowUps) == 0 && !m.unique
+}
+
 type TaskExecutionError struct {
 	Timestamp time.Time `json:"timestamp"`
 	Error     string    `json:"error"`
 	Traceback string    `json:"traceback"`
+	// RetryAt is set when the failed task is to be attempted
+	// again, and is when it becomes ready to do so.
+	RetryAt time.Time `json:"retry_at,omitempty"`
+	// Kind is how the error was classified, which decided
+	// whether the task was retried, dead-lettered or skipped.
+	Kind ErrorKind `json:"kind,omitempty"`
 }
 
 type TaskErrors struct {
@@ -41,6 +145,14 @@ func (te *TaskErrors) Add(err TaskExecutionError) {
 	te.Errors = append(te.Errors, err)
 }
 
+// Last returns the most recent error, if there is one.
+func (te *TaskErrors) Last() (TaskExecutionError, bool) {
+	if len(te.Errors) == 0 {
+		return TaskExecutionError{}, false
+	}
+	return te.Errors[len(te.Errors)-1], true
+}
+
 func (te *TaskErrors) ReadFrom(errFile Path) error {
 	if errFile.Exists() {
 		data, _ := errFile.Read()
@@ -66,15 +178,87 @@ func (te *TaskErrors) WriteTo(errFile Path) error {
 
 const FOO = 100
 
+// ErrTaskTimeout is recorded for a task that exceeded
+// its execution timeout.
+var ErrTaskTimeout = errors.New("task execution timed out")
+
+// ErrTaskLocked is returned when a task instance is already
+// claimed by another owner.
+var ErrTaskLocked = errors.New("task is locked")
+
+// ErrTaskNotErrored is returned when resetting a task
+// instance that has no errors to be reset.
+var ErrTaskNotErrored = errors.New("task has no errors")
+
+// heldLocks tracks the task locks acquired by this process so
+// that any copy of a TaskInstance can release them.
+var heldLocks = struct {
+	sync.Mutex
+	locks map[memLockKey]*FileLock
+}{locks: make(map[memLockKey]*FileLock)}
+
+// TaskState is the name of the queue sub directory a
+// task instance currently lives in.
+type TaskState string
+
+const (
+	StatePending   TaskState = "pending"
+	StateRunning   TaskState = "running"
+	StateDone      TaskState = "done"
+	StateFailed    TaskState = "failed"
+	StateExpired   TaskState = "expired"
+	StateCancelled TaskState = "cancelled"
+)
+
+var taskStates = []TaskState{StatePending, StateRunning, StateDone, StateFailed, StateExpired, StateCancelled}
+
+func isTaskState(name string) bool {
+	for _, state := range taskStates {
+		if string(state) == name {
+			return true
+		}
+	}
+	return false
+}
+
 // TaskInstance represents a unique task and is represented
 // on a file system as a directory that contains at least a single
 // json file with that task's execution arguments.
 // The task directory can also contain a lock file and/or an
-// error file.
+// error file. Within a TaskQueue the task directory lives in
+// one of the pending, running, done or failed state directories
+// and is moved between them with an atomic rename.
 type TaskInstance struct {
-	root Path
-	name string
-	id   string
+	root     Path
+	name     string
+	id       string
+	priority int
+	// lock is the lock taken by Claim, which belongs to
+	// this instance rather than to the process.
+	lock *FileLock
+}
+
+// taskDirName returns the name of the directory of a task. A
+// priority other than zero is added as a ".p<priority>" suffix,
+// so task instances can be ordered without reading their files.
+func taskDirName(id string, priority int) string {
+	if priority == 0 {
+		return id
+	}
+	return fmt.Sprintf("%s.p%d", id, priority)
+}
+
+// parseTaskDirName returns the id and priority of a task directory.
+func parseTaskDirName(name string) (string, int) {
+	i := strings.LastIndex(name, ".p")
+	if i < 1 {
+		return name, 0
+	}
+	priority, err := strconv.Atoi(name[i+2:])
+	if err != nil {
+		return name, 0
+	}
+	return name[:i], priority
 }
 
 // Initialize creates the task directory and applies a lock.
@@ -88,26 +272,195 @@ func (ti TaskInstance) Initialize() error {
 
 // Actions
 
-// Remove deletes the task folder and all it's files.
+// Remove deletes the task folder and all it's files, releasing
+// the task lock if it is held by this process.
 func (tq TaskInstance) Remove() error {
-	return tq.root.Remove()
+	lock := tq.takeLock()
+	if lock != nil {
+		defer lock.Release()
+	}
+	return tq.root.RemoveAll()
 }
 
-// ApplyLock create a .lock file in the task folder.
+// ApplyLock claims the task by taking an exclusive lock on
+// the .lock file in the task folder. ErrTaskLocked is returned
+// if the task is already claimed, by this or any other process.
 func (tq TaskInstance) ApplyLock() error {
-	err := tq.LockFile().Write([]byte{})
+	lockFile := tq.LockFile()
+	lock := NewFileLock(lockFile.fs, lockFile.String())
+	err := lock.TryAcquire()
+	if errors.Is(err, ErrLocked) {
+		return fmt.Errorf("%w: %s", ErrTaskLocked, tq.id)
+	}
+	if err != nil {
+		return err
+	}
+	err = writeLease(lock, NewLease(DefaultLeaseDuration))
 	if err != nil {
+		_ = lock.Release()
 		return err
 	}
+	heldLocks.Lock()
+	heldLocks.locks[tq.lockKey()] = lock
+	heldLocks.Unlock()
 	return nil
 }
 
-// ReleaseLock deletes the .lock file in the task folder.
+// ReleaseLock deletes the .lock file in the task folder and
+// releases the lock held on it. A stale .lock file nobody holds
+// is removed as well, but a lock held by another owner is not
+// touched and ErrTaskLocked is returned.
 func (ti TaskInstance) ReleaseLock() error {
-	if ti.LockFile().Exists() {
-		return ti.LockFile().Remove()
+	// the lock of a claimed task was already released.
+	if ti.lock != nil && ti.lock.File() == nil {
+		return nil
 	}
-	return nil
+	lock := ti.takeLock()
+	if lock != nil && lock.File() == nil {
+		return nil
+	}
+	if lock == nil {
+		if ti.IsLocked() {
+			return fmt.Errorf("%w: %s", ErrTaskLocked, ti.id)
+		}
+		if ti.LockFile().Exists() {
+			return ti.LockFile().Remove()
+		}
+		return nil
+	}
+	// a reclaimed task's lock file belongs to somebody else.
+	if !sameFile(lock.fs, lock.File(), ti.LockFile().String()) {
+		return lock.Release()
+	}
+	// remove the file before unlocking so that nobody can
+	// claim the lock file we are about to discard.
+	err := ti.LockFile().Remove()
+	if err != nil && ti.LockFile().Exists() {
+		_ = lock.Release()
+		return err
+	}
+	return lock.Release()
+}
+
+// Claim locks a pending task and moves it into the running
+// state, returning the instance at its new location. Only one
+// claim on a task can ever succeed; every other claimer gets
+// ErrTaskLocked.
+func (ti TaskInstance) Claim() (TaskInstance, error) {
+	if ti.State() != StatePending {
+		return ti, fmt.Errorf("cannot claim %s task %s", ti.State(), ti.id)
+	}
+	ti.lock = nil
+	err := ti.ApplyLock()
+	if errors.Is(err, os.ErrNotExist) {
+		// somebody else has already moved it out of pending.
+		return ti, fmt.Errorf("%w: %s", ErrTaskLocked, ti.id)
+	}
+	if err != nil {
+		return ti, err
+	}
+	ti.lock = ti.takeLock()
+	running, err := ti.MoveTo(StateRunning)
+	if err != nil {
+		_ = ti.ReleaseLock()
+		if errors.Is(err, os.ErrNotExist) {
+			return ti, fmt.Errorf("%w: %s", ErrTaskLocked, ti.id)
+		}
+		return ti, err
+	}
+	return running, nil
+}
+
+// MoveTo renames the task folder into the given state directory
+// of its queue and returns the instance at its new location. A
+// lock held on the task moves along with it.
+func (ti TaskInstance) MoveTo(state TaskState) (TaskInstance, error) {
+	return ti.moveInto(ti.root.Parent().Parent().Join(string(state)))
+}
+
+func (ti TaskInstance) moveInto(dir Path) (TaskInstance, error) {
+	moved := ti
+	moved.root = dir.Join(ti.root.Name())
+	err := ti.root.Rename(moved.root)
+	if err != nil {
+		return ti, err
+	}
+	if ti.lock != nil {
+		return moved, nil
+	}
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	lock, ok := heldLocks.locks[ti.lockKey()]
+	if ok {
+		delete(heldLocks.locks, ti.lockKey())
+		heldLocks.locks[moved.lockKey()] = lock
+	}
+	return moved, nil
+}
+
+func (ti TaskInstance) lockKey() memLockKey {
+	return memLockKey{fs: ti.root.fs, name: ti.LockFile().String()}
+}
+
+// heldLock returns the lock held on this task by the
+// current process, if any.
+func (ti TaskInstance) heldLock() *FileLock {
+	if ti.lock != nil {
+		return ti.acquiredLock()
+	}
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	return heldLocks.locks[ti.lockKey()]
+}
+
+// acquiredLock returns the lock of a claimed task, unless
+// it has been released since it was claimed.
+func (ti TaskInstance) acquiredLock() *FileLock {
+	if ti.lock.File() == nil {
+		return nil
+	}
+	return ti.lock
+}
+
+// takeLock removes and returns the lock held on this task by
+// the current process, if any.
+func (ti TaskInstance) takeLock() *FileLock {
+	if ti.lock != nil {
+		return ti.acquiredLock()
+	}
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	key := ti.lockKey()
+	lock, ok := heldLocks.locks[key]
+	if !ok {
+		return nil
+	}
+	delete(heldLocks.locks, key)
+	return lock
+}
+
+// GetMeta reads the task meta file. A task sent without any
+// settings has no meta file and returns an empty TaskMeta.
+func (ti TaskInstance) GetMeta() (TaskMeta, error) {
+	meta := TaskMeta{}
+	if !ti.MetaFile().Exists() {
+		return meta, nil
+	}
+	data, err := ti.MetaFile().Read()
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// WriteMeta writes the task meta file.
+func (ti TaskInstance) WriteMeta(meta TaskMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return ti.MetaFile().Write(data)
 }
 
 func (tq TaskInstance) GetErrors() (TaskErrors, error) {
@@ -121,11 +474,15 @@ func (tq TaskInstance) GetErrors() (TaskErrors, error) {
 
 // WriteError writes an error message to the tasks error file.
 func (tq TaskInstance) WriteError(msg string, traceback string) error {
-	errMsg := TaskExecutionError{
+	return tq.AddError(TaskExecutionError{
 		Timestamp: time.Now(),
 		Error:     msg,
 		Traceback: traceback,
-	}
+	})
+}
+
+// AddError appends errMsg to the tasks error file.
+func (tq TaskInstance) AddError(errMsg TaskExecutionError) error {
 	errFile := tq.ErrorFile()
 
 	errors, err := tq.GetErrors()
@@ -141,22 +498,169 @@ func (tq TaskInstance) WriteError(msg string, traceback string) error {
 	return nil
 }
 
+// GetHistory returns every error the task has recorded: the
+// archived ones from earlier runs followed by the current ones.
+func (ti TaskInstance) GetHistory() (TaskErrors, error) {
+	history := TaskErrors{}
+	err := history.ReadFrom(ti.HistoryFile())
+	if err != nil {
+		return history, err
+	}
+	current, err := ti.GetErrors()
+	if err != nil {
+		return history, err
+	}
+	history.Errors = append(history.Errors, current.Errors...)
+	return history, nil
+}
+
+// Reset makes an errored task instance runnable again by clearing
+// its errors and moving it back into pending. With keepHistory the
+// errors are archived into the history file, otherwise the history
+// is discarded as well. ErrTaskLocked is returned for a task that
+// is being executed, and ErrTaskNotErrored for one without errors.
+// A task in done is never reset. The task is locked while it is
+// reset, so it cannot be claimed half way.
+func (ti TaskInstance) Reset(keepHistory bool) (TaskInstance, error) {
+	err := ti.ApplyLock()
+	if err != nil {
+		return ti, err
+	}
+	reset, err := ti.reset(keepHistory)
+	return reset, errors.Join(err, reset.ReleaseLock())
+}
+
+func (ti TaskInstance) reset(keepHistory bool) (TaskInstance, error) {
+	if ti.State() == StateDone {
+		return ti, fmt.Errorf("cannot reset %s task %s", ti.State(), ti.id)
+	}
+	if !ti.HasError() {
+		return ti, fmt.Errorf("%w: %s", ErrTaskNotErrored, ti.id)
+	}
+	if keepHistory {
+		err := ti.archiveErrors()
+		if err != nil {
+			return ti, err
+		}
+	} else {
+		for _, file := range []Path{ti.ErrorFile(), ti.HistoryFile()} {
+			err := file.Remove()
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return ti, err
+			}
+		}
+	}
+	if ti.State() == StatePending {
+		return ti, nil
+	}
+	return ti.MoveTo(StatePending)
+}
+
+// archiveErrors appends the current errors to the task
+// history file and removes the error file.
+func (ti TaskInstance) archiveErrors() error {
+	if !ti.HasError() {
+		return nil
+	}
+	history, err := ti.GetHistory()
+	if err != nil {
+		return err
+	}
+	err = history.WriteTo(ti.HistoryFile())
+	if err != nil {
+		return err
+	}
+	return ti.ErrorFile().Remove()
+}
+
 // Status
 
+// Priority returns the priority the task was sent with.
+func (ti TaskInstance) Priority() int {
+	return ti.priority
+}
+
+// SentAt returns the time the task was sent, as recorded in its
+// id. For ids of earlier versions, which hold no time, it is the
+// modification time of the task file.
+func (ti TaskInstance) SentAt() time.Time {
+	sentAt, ok := taskIdTime(ti.id)
+	if ok {
+		return sentAt
+	}
+	sentAt, _ = ti.TaskFile().ModTime()
+	return sentAt
+}
+
+// State returns the state directory the task folder is in.
+func (ti TaskInstance) State() TaskState {
+	return TaskState(ti.root.Parent().Name())
+}
+
 // Exists is true if the task folder exists.
 func (tq TaskInstance) Exists() bool {
 	return tq.TaskDir().Exists()
 }
 
 // IsReady is true if the task folder has a task file and
-// is not locked and has no errors.
+// is not locked and is due: its run at time has come, and it
+// has no errors or has failed before and its retry time has come.
 func (tq TaskInstance) IsReady() bool {
-	return tq.TaskFile().Exists() && !tq.IsLocked() && !tq.HasError()
+	return tq.TaskFile().Exists() && !tq.IsLocked() && tq.isDue()
+}
+
+func (tq TaskInstance) isDue() bool {
+	dueAt, ok := tq.DueAt()
+	return ok && !time.Now().Before(dueAt)
+}
+
+// DueAt returns the time the task becomes due, the later of its
+// run at and retry times. It is false for a task with errors that
+// is not going to be retried.
+func (tq TaskInstance) DueAt() (time.Time, bool) {
+	dueAt, _ := tq.RunAt()
+	if !tq.HasError() {
+		return dueAt, true
+	}
+	retryAt, ok := tq.RetryAt()
+	if !ok {
+		return time.Time{}, false
+	}
+	if retryAt.After(dueAt) {
+		dueAt = retryAt
+	}
+	return dueAt, true
+}
+
+// RunAt returns the time the task was sent to run at.
+// It is false if the task was sent to run right away.
+func (tq TaskInstance) RunAt() (time.Time, bool) {
+	meta, err := tq.GetMeta()
+	if err != nil || meta.RunAt.IsZero() {
+		return time.Time{}, false
+	}
+	return meta.RunAt, true
 }
 
-// IsLocked is true if the task folder contains a .lock file.
+// RetryAt returns the time a failed task is to be retried
+// at. It is false if the task is not going to be retried.
+func (tq TaskInstance) RetryAt() (time.Time, bool) {
+	errors, err := tq.GetErrors()
+	if err != nil {
+		return time.Time{}, false
+	}
+	last, ok := errors.Last()
+	if !ok || last.RetryAt.IsZero() {
+		return time.Time{}, false
+	}
+	return last.RetryAt, true
+}
+
+// IsLocked is true if the task folder contains a .lock file
+// that is currently held by this or any other process.
 func (tq TaskInstance) IsLocked() bool {
-	return tq.LockFile().Exists()
+	lockFile := tq.LockFile()
+	return IsFileLocked(lockFile.fs, lockFile.String())
 }
 
 // HasError is true if the task folder contains a .error ffile.
@@ -174,11 +678,27 @@ func (tq TaskInstance) TaskFile() Path {
 	return tq.TaskDir().Join(fmt.Sprintf("%s.json", tq.id))
 }
 
+// MetaFile returns the Path object of the task meta file.
+func (ti TaskInstance) MetaFile() Path {
+	return ti.TaskDir().Join(fmt.Sprintf("%s.meta", ti.id))
+}
+
 // ErrorFile returns the Path object of the task error file.
 func (tq TaskInstance) ErrorFile() Path {
 	return tq.TaskDir().Join(fmt.Sprintf("%s.error", tq.id))
 }
 
+// ResultFile returns the Path object of the task result file.
+func (ti TaskInstance) ResultFile() Path {
+	return ti.TaskDir().Join(fmt.Sprintf("%s.result", ti.id))
+}
+
+// HistoryFile returns the Path object of the file holding
+// the errors archived when the task was requeued.
+func (ti TaskInstance) HistoryFile() Path {
+	return ti.TaskDir().Join(fmt.Sprintf("%s.history", ti.id))
+}
+
 // LockFile returns the Path object of the task lock file.
 func (tq TaskInstance) LockFile() Path {
 	return tq.TaskDir().Join(fmt.Sprintf("%s.lock", tq.id))
@@ -188,55 +708,66 @@ func (tq TaskInstance) String() string {
 	return tq.root.String()
 }
 
-type ExecuteTaskErr struct {
-	Name  string
-	Error error
-}
+// Outcome describes how an attempt to execute a task instance ended.
+type Outcome string
+
+const (
+	// OutcomeSucceeded means the task executed without error.
+	OutcomeSucceeded Outcome = "succeeded"
+	// OutcomeFailed means the task executor returned an error.
+	OutcomeFailed Outcome = "failed"
+	// OutcomeSkipped means the task was claimed by somebody else.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeError means the queue itself failed to process the task.
+	OutcomeError Outcome = "error"
+	// OutcomeRetrying means the task failed, or timed out, and was
+	// returned to pending to be attempted again.
+	OutcomeRetrying Outcome = "retrying"
+	// OutcomeTimedOut means the task exceeded its execution timeout.
+	OutcomeTimedOut Outcome = "timed out"
+	// OutcomeInterrupted means the run was cancelled while the task
+	// was executing, and it was returned to pending.
+	OutcomeInterrupted Outcome = "interrupted"
+	// OutcomeExpired means the task was not executed because it
+	// had expired, and was moved into expired instead.
+	OutcomeExpired Outcome = "expired"
+	// OutcomeCancelled means the task was cancelled before,
+	// or while, it was executed.
+	OutcomeCancelled Outcome = "cancelled"
+)
 
-func NewExecutTaskErr(name string, err error) ExecuteTaskErr {
-	return ExecuteTaskErr{
-		Name:  name,
-		Error: err,
-	}
+// TaskResult reports the execution of a single task instance.
+type TaskResult struct {
+	Queue    string
+	Id       string
+	Outcome  Outcome
+	Duration time.Duration
+	Error    error
 }
 
-func UnwrapChannel(c chan ExecuteTaskErr) []error {
-	var errors []error
-	for err := range c {
-		errors = append(errors, err.Error)
-	}
-	if len(errors) > 0 {
-		return errors
-	}
-	return nil
+// RunReport collects the results of a run over many task instances.
+type RunReport struct {
+	Results []TaskResult
 }
 
-func ExecuteTask(task TaskExecutor, instance TaskInstance, c chan<- ExecuteTaskErr) {
-	instance.LockFile()
-	defer func() {
-		err := instance.ReleaseLock()
-		c <- NewExecutTaskErr(instance.name, err)
-	}()
-
-	data, err := instance.TaskFile().Read()
-	if err != nil {
-		c <- NewExecutTaskErr(instance.name, err)
-		return
-	}
-
-	err = task.Execute(data)
-	if err != nil {
-		err = instance.WriteError(err.Error(), "")
-		if err != nil {
-			c <- NewExecutTaskErr(instance.name, err)
-			return
+// Count returns the number of results with the given outcome.
+func (r RunReport) Count(outcome Outcome) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Outcome == outcome {
+			count += 1
 		}
-		return
 	}
+	return count
+}
 
-	err = instance.Remove()
-	if err != nil {
-		c <- NewExecutTaskErr(instance.name, err)
+// Errors returns the errors of every failed or errored result.
+func (r RunReport) Errors() []error {
+	var errors []error
+	for _, result := range r.Results {
+		if result.Error != nil {
+			errors = append(errors, result.Error)
+		}
 	}
-	return
+	return errors
 }
@@ -1,9 +1,11 @@
 package queue
 
 import (
+	"context"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func MakeTasInstance() TaskInstance {
@@ -91,3 +93,159 @@ func TestTaskInstance_WriteError(t *testing.T) {
 	assert.Equal(t, 2, errors.Count())
 
 }
+
+func TestTaskInstance_Claim(t *testing.T) {
+	tq := MakeTaskQueue(false)
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	assert.Equal(t, StatePending, ti.State())
+
+	running, err := ti.Claim()
+	assert.Nil(t, err)
+	assert.Equal(t, StateRunning, running.State())
+	assert.True(t, running.IsLocked())
+	assert.True(t, running.TaskFile().Exists())
+	assert.False(t, ti.Exists())
+
+	// the task has already been claimed.
+	_, err = ti.Claim()
+	assert.ErrorIs(t, err, ErrTaskLocked)
+
+	done, err := running.MoveTo(StateDone)
+	assert.Nil(t, err)
+	assert.True(t, done.IsLocked())
+
+	err = done.ReleaseLock()
+	assert.Nil(t, err)
+	assert.False(t, done.IsLocked())
+	assert.False(t, done.LockFile().Exists())
+
+	// the released lock is left alone.
+	assert.Nil(t, done.ReleaseLock())
+	assert.Nil(t, done.Remove())
+	assert.False(t, done.Exists())
+}
+
+type SleepTask struct{}
+
+func (t *SleepTask) Assert(opt any) error {
+	return nil
+}
+
+func (t *SleepTask) ExecuteContext(ctx context.Context, jsonData []byte) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+func TestContextExecutor(t *testing.T) {
+	task := &ConcreteTask{}
+	executor := ContextExecutor(task)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := executor.ExecuteContext(ctx, []byte(`{"id":1,"name":"Hello!"}`))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, task.Executed)
+
+	err = executor.ExecuteContext(context.Background(), []byte(`{"id":1,"name":"Hello!"}`))
+	assert.Nil(t, err)
+	assert.True(t, task.Executed)
+}
+
+func TestTaskQueue_ExecuteTaskContext(t *testing.T) {
+	tq, err := NewContextTaskQueue(
+		NewPath("/localq", afero.NewMemMapFs(), 0777),
+		"sleep",
+		&SleepTask{},
+	)
+	assert.Nil(t, err)
+	assert.NotNil(t, tq.Task())
+
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	// a task cancelled mid execution goes back to pending.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result := tq.ExecuteTaskContext(ctx, ti)
+	assert.Equal(t, OutcomeInterrupted, result.Outcome)
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.True(t, ti.IsReady())
+	assert.False(t, ti.HasError())
+
+	// and nothing new is started once the context is done.
+	result = tq.ExecuteTaskContext(ctx, ti)
+	assert.Equal(t, OutcomeSkipped, result.Outcome)
+	assert.True(t, ti.IsReady())
+}
+
+func TestTaskInstance_Reset(t *testing.T) {
+	tq := MakeTaskQueue(true)
+	ti, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+	tq.ExecuteTask(ti)
+
+	failed, err := tq.DeadLetter(ti.id)
+	assert.Nil(t, err)
+	reset, err := failed.Reset(true)
+	assert.Nil(t, err)
+	assert.Equal(t, StatePending, reset.State())
+	assert.False(t, reset.IsLocked())
+	assert.False(t, reset.HasError())
+	assert.True(t, reset.HistoryFile().Exists())
+	history, err := reset.GetHistory()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, history.Count())
+
+	tq.ExecuteTask(reset)
+	failed, err = tq.DeadLetter(ti.id)
+	assert.Nil(t, err)
+	reset, err = failed.Reset(false)
+	assert.Nil(t, err)
+	assert.False(t, reset.HasError())
+	assert.False(t, reset.HistoryFile().Exists())
+	assert.True(t, reset.IsReady())
+
+	// a task being executed cannot be reset.
+	claimed, err := reset.Claim()
+	assert.Nil(t, err)
+	_, err = claimed.Reset(true)
+	assert.ErrorIs(t, err, ErrTaskLocked)
+	assert.Nil(t, claimed.ReleaseLock())
+
+	// neither can a task without errors, nor one that succeeded.
+	_, err = claimed.Reset(true)
+	assert.ErrorIs(t, err, ErrTaskNotErrored)
+	assert.Nil(t, claimed.WriteError("failed before", ""))
+	done, err := claimed.MoveTo(StateDone)
+	assert.Nil(t, err)
+	_, err = done.Reset(true)
+	assert.NotNil(t, err)
+	assert.Equal(t, StateDone, done.State())
+}
+
+func TestParseTaskDirName(t *testing.T) {
+	cases := []struct {
+		name     string
+		id       string
+		priority int
+	}{
+		{"V1StGXR8_Z5jdHi", "V1StGXR8_Z5jdHi", 0},
+		{"V1StGXR8_Z5jdHi.p10", "V1StGXR8_Z5jdHi", 10},
+		{"V1StGXR8_Z5jdHi.p-3", "V1StGXR8_Z5jdHi", -3},
+		{"V1StGXR8_Z5jdHi.px", "V1StGXR8_Z5jdHi.px", 0},
+		{".p5", ".p5", 0},
+	}
+	for _, c := range cases {
+		id, priority := parseTaskDirName(c.name)
+		assert.Equal(t, c.id, id, c.name)
+		assert.Equal(t, c.priority, priority, c.name)
+	}
+	assert.Equal(t, "abc", taskDirName("abc", 0))
+	assert.Equal(t, "abc.p-2", taskDirName("abc", -2))
+}
@@ -0,0 +1,148 @@
+//go:build linux
+
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// queueDirEvents are watched on the pending and running
+	// directories: task directories arriving and leaving.
+	queueDirEvents = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_ONLYDIR
+	// taskDirEvents are watched on each pending task directory:
+	// the .lock file being released once a task has been sent.
+	taskDirEvents = syscall.IN_DELETE | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+)
+
+// inotifyWatcher nudges a worker whenever a task directory is
+// added to or removed from a queue, or a pending task is unlocked.
+type inotifyWatcher struct {
+	fd      int
+	file    *os.File
+	mu      sync.Mutex
+	watches map[int32]string
+	nudge   chan struct{}
+}
+
+// watchQueues returns a channel that receives whenever the pending or
+// running directories of the master's queues change. A nil channel is
+// returned for file systems inotify cannot watch, leaving the caller
+// to poll.
+func watchQueues(ctx context.Context, master *MasterQ) (<-chan struct{}, error) {
+	if !isOsFs(master.fs) {
+		return nil, nil
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		fd: fd,
+		// a non-blocking descriptor is handed to the runtime poller,
+		// so closing the file interrupts a pending read.
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32]string),
+		nudge:   make(chan struct{}, 1),
+	}
+	for _, name := range master.Names() {
+		queue := master.tasks[name]
+		for _, state := range []TaskState{StatePending, StateRunning} {
+			err = w.add(queue.StateDir(state).String(), queueDirEvents)
+			if err != nil {
+				w.file.Close()
+				return nil, err
+			}
+		}
+		tasks, err := queue.GetTaskInstances()
+		if err != nil {
+			w.file.Close()
+			return nil, err
+		}
+		for _, task := range tasks {
+			_ = w.add(task.TaskDir().String(), taskDirEvents)
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		w.file.Close()
+	}()
+	go w.read()
+	return w.nudge, nil
+}
+
+func (w *inotifyWatcher) add(dir string, mask uint32) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, mask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	w.mu.Lock()
+	w.watches[int32(wd)] = dir
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *inotifyWatcher) remove(wd int32) {
+	w.mu.Lock()
+	delete(w.watches, wd)
+	w.mu.Unlock()
+	_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+}
+
+func (w *inotifyWatcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			name := string(trimNul(buf[nameStart:nameEnd]))
+			w.handle(event, name)
+			offset = nameEnd
+		}
+		select {
+		case w.nudge <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *inotifyWatcher) handle(event *syscall.InotifyEvent, name string) {
+	w.mu.Lock()
+	dir, ok := w.watches[event.Wd]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+	switch {
+	case event.Mask&syscall.IN_IGNORED != 0:
+		w.mu.Lock()
+		delete(w.watches, event.Wd)
+		w.mu.Unlock()
+	case event.Mask&syscall.IN_MOVE_SELF != 0:
+		// the task has left pending, so its lock is no longer of interest.
+		w.remove(event.Wd)
+	case event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		if TaskState(filepath.Base(dir)) == StatePending {
+			_ = w.add(filepath.Join(dir, name), taskDirEvents)
+		}
+	}
+}
+
+func trimNul(name []byte) []byte {
+	for i, b := range name {
+		if b == 0 {
+			return name[:i]
+		}
+	}
+	return name
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package queue
+
+import (
+	"context"
+)
+
+// watchQueues is only implemented with inotify on linux;
+// everywhere else the worker polls.
+func watchQueues(ctx context.Context, master *MasterQ) (<-chan struct{}, error) {
+	return nil, nil
+}
@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrShutdownTimeout is returned by Worker.Run when in-flight task
+// instances did not finish within the shutdown timeout.
+var ErrShutdownTimeout = errors.New("worker shutdown timed out")
+
+const (
+	DefaultPollInterval    = time.Second
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+// WorkerOptions configure a Worker. Zero values are
+// replaced with their defaults.
+type WorkerOptions struct {
+	// Concurrency is the maximum number of task instances the
+	// worker executes at the same time. Defaults to the number
+	// of CPUs.
+	Concurrency int
+	// PollInterval is how long the worker waits between scans
+	// of the queues.
+	PollInterval time.Duration
+	// ShutdownTimeout is how long the worker waits for in-flight
+	// task instances to finish once it has been stopped.
+	ShutdownTimeout time.Duration
+	// Watch reacts to new and unlocked task instances as soon as
+	// they appear, using inotify on linux. Queues on a file system
+	// that cannot be watched, such as afero.MemMapFs, are polled.
+	Watch bool
+	// OnResult, if set, is called with the result of every task
+	// instance the worker executes. It must be safe to call
+	// from many goroutines.
+	OnResult func(TaskResult)
+}
+
+// Worker continuously scans the queues registered with a MasterQ
+// and executes their ready task instances.
+type Worker struct {
+	master *MasterQ
+	opts   WorkerOptions
+}
+
+func NewWorker(master *MasterQ, opts WorkerOptions) *Worker {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = runtime.NumCPU()
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	return &Worker{
+		master: master,
+		opts:   opts,
+	}
+}
+
+// Run scans and executes task instances until ctx is cancelled or
+// the process receives SIGINT or SIGTERM. It then stops claiming new
+// task instances and waits up to the shutdown timeout for in-flight
+// ones to finish. If they do not, their contexts are cancelled and
+// ErrShutdownTimeout is returned.
+func (w *Worker) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// in-flight tasks outlive ctx until the shutdown timeout.
+	execCtx, cancelExec := context.WithCancel(context.Background())
+	defer cancelExec()
+
+	slots := make(chan struct{}, w.opts.Concurrency)
+	var inFlight sync.WaitGroup
+
+	var changed <-chan struct{}
+	if w.opts.Watch {
+		var err error
+		changed, err = watchQueues(ctx, w.master)
+		if err != nil {
+			w.report(TaskResult{Outcome: OutcomeError, Error: err})
+		}
+	}
+
+	// when watching, polling still picks up orphaned
+	// instances and anything the watcher missed.
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.scan(ctx, execCtx, slots, &inFlight)
+		// sleep no longer than until the next delayed
+		// or retried instance becomes due.
+		var due <-chan time.Time
+		var timer *time.Timer
+		if next, ok := w.master.NextDue(); ok {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return w.shutdown(&inFlight, cancelExec)
+		case <-ticker.C:
+		case <-changed:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// scan reclaims orphaned task instances, moves expired ones out
+// of the way, purges results past their retention and stale key
+// records, and dispatches every ready one, waiting for a free slot
+// as needed.
+func (w *Worker) scan(ctx context.Context, execCtx context.Context, slots chan struct{}, inFlight *sync.WaitGroup) {
+	_, err := w.master.ReapOrphanedTasks()
+	if err != nil {
+		w.report(TaskResult{Outcome: OutcomeError, Error: err})
+	}
+	expired, err := w.master.ExpireTasks()
+	if err != nil {
+		w.report(TaskResult{Outcome: OutcomeError, Error: err})
+	}
+	for _, task := range expired {
+		w.report(TaskResult{Queue: task.name, Id: task.id, Outcome: OutcomeExpired})
+	}
+	_, err = w.master.PurgeResults()
+	if err != nil {
+		w.report(TaskResult{Outcome: OutcomeError, Error: err})
+	}
+	_, err = w.master.PurgeKeys()
+	if err != nil {
+		w.report(TaskResult{Outcome: OutcomeError, Error: err})
+	}
+	for _, name := range w.master.Names() {
+		queue := w.master.tasks[name]
+		tasks, err := queue.ReadyTaskInstances()
+		if err != nil {
+			w.report(TaskResult{Queue: name, Outcome: OutcomeError, Error: err})
+			continue
+		}
+		for _, task := range tasks {
+			select {
+			case <-ctx.Done():
+				return
+			case slots <- struct{}{}:
+			}
+			inFlight.Add(1)
+			go func(queue TaskQueue, task TaskInstance) {
+				defer inFlight.Done()
+				defer func() { <-slots }()
+				w.report(queue.ExecuteTaskContext(execCtx, task))
+			}(queue, task)
+		}
+	}
+}
+
+func (w *Worker) shutdown(inFlight *sync.WaitGroup, cancelExec context.CancelFunc) error {
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(w.opts.ShutdownTimeout):
+		cancelExec()
+		return ErrShutdownTimeout
+	}
+}
+
+func (w *Worker) report(result TaskResult) {
+	if w.opts.OnResult != nil {
+		w.opts.OnResult(result)
+	}
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type BlockingTask struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (t *BlockingTask) Assert(opt any) error {
+	return nil
+}
+
+func (t *BlockingTask) Execute(jsonData []byte) error {
+	t.started <- struct{}{}
+	<-t.release
+	return nil
+}
+
+func MakeBlockingMaster(t *testing.T) (*MasterQ, *BlockingTask) {
+	master, err := New(t.TempDir(), afero.NewMemMapFs(), 0777)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		delete(globalQ, master.root.String())
+	})
+	task := &BlockingTask{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+	err = master.Register(task, "blocking")
+	require.Nil(t, err)
+	return master, task
+}
+
+func TestWorker_Run(t *testing.T) {
+	master, task := MakeBlockingMaster(t)
+	tq := master.Enqueue("blocking")
+
+	var mu sync.Mutex
+	var results []TaskResult
+	worker := NewWorker(master, WorkerOptions{
+		Concurrency:  2,
+		PollInterval: 10 * time.Millisecond,
+		OnResult: func(result TaskResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, result)
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- worker.Run(ctx)
+	}()
+
+	for i := 1; i <= 3; i++ {
+		_, err := tq.Send(TaskOptions{Id: i, Name: "Hello!"})
+		assert.Nil(t, err)
+	}
+
+	// only two instances are executed at the same time.
+	<-task.started
+	<-task.started
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, len(task.started))
+
+	running, err := tq.GetTaskInstancesIn(StateRunning)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(running))
+
+	// once stopped no new instances are claimed, but the
+	// in-flight ones are allowed to finish.
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(task.release)
+	assert.Nil(t, <-stopped)
+
+	done, err := tq.GetTaskInstancesIn(StateDone)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(done))
+	for _, ti := range done {
+		assert.False(t, ti.IsLocked())
+	}
+
+	pending, err := tq.GetTaskInstances()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, len(results))
+	for _, result := range results {
+		assert.Equal(t, OutcomeSucceeded, result.Outcome)
+	}
+}
+
+func TestWorker_ShutdownTimeout(t *testing.T) {
+	master, task := MakeBlockingMaster(t)
+	tq := master.Enqueue("blocking")
+	defer close(task.release)
+
+	_, err := tq.Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	worker := NewWorker(master, WorkerOptions{
+		PollInterval:    10 * time.Millisecond,
+		ShutdownTimeout: 10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- worker.Run(ctx)
+	}()
+
+	<-task.started
+	cancel()
+	assert.ErrorIs(t, <-stopped, ErrShutdownTimeout)
+}
+
+func TestWorker_Watch(t *testing.T) {
+	master, err := New(t.TempDir(), afero.NewOsFs(), 0777)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		delete(globalQ, master.root.String())
+	})
+	task := &BlockingTask{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+	close(task.release)
+	err = master.Register(task, "blocking")
+	require.Nil(t, err)
+
+	// with an hour between polls, only the watcher
+	// can pick up the task in time.
+	worker := NewWorker(master, WorkerOptions{
+		PollInterval: time.Hour,
+		Watch:        true,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- worker.Run(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = master.Enqueue("blocking").Send(TaskOptions{Id: 1, Name: "Hello!"})
+	assert.Nil(t, err)
+
+	select {
+	case <-task.started:
+	case <-time.After(5 * time.Second):
+		t.Error("task was not started by the watcher")
+	}
+
+	cancel()
+	assert.Nil(t, <-stopped)
+}
+
+func TestWorker_RunDelayed(t *testing.T) {
+	master, task := MakeBlockingMaster(t)
+	tq := master.Enqueue("blocking")
+	close(task.release)
+
+	// sent before the worker's first scan, the instance is
+	// only picked up by sleeping until it is due.
+	_, err := tq.SendAfter(TaskOptions{Id: 1, Name: "Hello!"}, 100*time.Millisecond)
+	assert.Nil(t, err)
+
+	worker := NewWorker(master, WorkerOptions{PollInterval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx)
+
+	select {
+	case <-task.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("delayed instance was not executed")
+	}
+}